@@ -4,8 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"reflect"
 	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
@@ -18,13 +20,16 @@ type Devices struct {
 }
 
 type Config struct {
-	Version       string    `yaml:"version"`
-	Timeout       string    `yaml:"timeout"`
-	MaxGoroutines int       `yaml:"max_goroutines"`
-	Interval      string    `yaml:"interval"`
-	Devices       Devices   `yaml:"devices"`
-	Storage       Options   `yaml:"storage"`
-	Filters       []*Filter `yaml:"filters"`
+	Version       string             `yaml:"version"`
+	Timeout       string             `yaml:"timeout"`
+	MaxGoroutines int                `yaml:"max_goroutines"`
+	Interval      string             `yaml:"interval"`
+	BindAddress   string             `yaml:"bind_address"`
+	BindInterface string             `yaml:"bind_interface"`
+	Devices       Devices            `yaml:"devices"`
+	Storage       Options            `yaml:"storage"`
+	Filters       []*Filter          `yaml:"filters"`
+	Profiles      map[string]Options `yaml:"profiles"`
 }
 
 type Filter struct {
@@ -97,6 +102,32 @@ func (o Options) GetBool(name string) (bool, error) {
 	}
 }
 
+// GetSecret returns a value taken either from the option itself, from an environment variable named
+// by `<name>_env' option or from a file named by `<name>_file' option. Trailing line break is removed from the file contents.
+func (o Options) GetSecret(name string) (string, error) {
+	if _, ok := o[name]; ok {
+		return o.GetString(name)
+	}
+
+	if env, _ := o.GetString(name + "_env"); env != "" {
+		val, ok := os.LookupEnv(env)
+		if !ok {
+			return "", fmt.Errorf("%s: environment variable %s is not set", name, env)
+		}
+		return val, nil
+	}
+
+	if file, _ := o.GetString(name + "_file"); file != "" {
+		buf, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", name, err)
+		}
+		return strings.TrimRight(string(buf), "\r\n"), nil
+	}
+
+	return "", ErrOptNotFound
+}
+
 func Load(name string) (*Config, error) {
 	buf, err := ioutil.ReadFile(name)
 	if err != nil {
@@ -0,0 +1,312 @@
+package devices
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ecadlabs/rosdump/config"
+	"github.com/ecadlabs/rosdump/rosapi"
+	"github.com/sirupsen/logrus"
+)
+
+// Default command. Requires RouterOS 7 supporting `as-string' argument
+var defaultAPICommand = []string{"/execute", "=script=/export", "=as-string="}
+
+var errAPIVersion = errors.New("can't get RouterOS version")
+
+type API struct {
+	Name           string
+	Host           string
+	Port           string
+	Commands       [][]string
+	Config         rosapi.Config
+	Logger         *logrus.Logger
+	ExportMetadata Metadata
+	DeviceMetadata Metadata
+}
+
+// splitAPIWords splits the command only before `=', `?' and `.' prefixed words so attribute values may contain spaces
+// i.e. `/execute =script=/export show-sensitive =as-string='
+func splitAPIWords(s string) []string {
+	var (
+		words []string
+		start = -1
+	)
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != ' ' && s[i] != '\t' {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+
+		j := i
+		for j < len(s) && (s[j] == ' ' || s[j] == '\t') {
+			j++
+		}
+
+		if start >= 0 && (j == len(s) || strings.IndexByte("=?.", s[j]) >= 0) {
+			words = append(words, s[start:i])
+			start = -1
+		}
+		i = j - 1
+	}
+
+	if start >= 0 {
+		words = append(words, s[start:])
+	}
+
+	return words
+}
+
+func quoteAPIValue(s string) string {
+	if s == "" || strings.IndexFunc(s, func(r rune) bool {
+		return r <= ' ' || r == '"' || r == '\\' || r == '=' || r == 0x7f
+	}) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func writeAPIReply(w io.Writer, res []*rosapi.Sentence) error {
+	for _, s := range res {
+		if s.Reply == "!re" {
+			words := make([]string, len(s.Attributes))
+			for i, a := range s.Attributes {
+				words[i] = a.Key + "=" + quoteAPIValue(a.Value)
+			}
+
+			if _, err := fmt.Fprintln(w, strings.Join(words, " ")); err != nil {
+				return err
+			}
+		} else if ret, ok := s.Get("ret"); ok {
+			// Script output
+			if _, err := io.WriteString(w, ret); err != nil {
+				return err
+			}
+
+			if !strings.HasSuffix(ret, "\n") {
+				if _, err := io.WriteString(w, "\n"); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// rosMajorVersion parses the major number of RouterOS version i.e. `7.14.3 (stable)'
+func rosMajorVersion(version string) (int, error) {
+	i := strings.IndexByte(version, '.')
+	if i < 0 {
+		return 0, fmt.Errorf("invalid RouterOS version: `%s'", version)
+	}
+
+	major, err := strconv.Atoi(version[:i])
+	if err != nil {
+		return 0, fmt.Errorf("invalid RouterOS version: `%s'", version)
+	}
+
+	return major, nil
+}
+
+// checkDefaultAPICommand fails early on devices not supporting the default command
+func checkDefaultAPICommand(client *rosapi.Client) error {
+	res, err := client.Run("/system/resource/print", "=.proplist=version")
+	if err != nil {
+		return err
+	}
+
+	var version string
+	for _, s := range res {
+		if v, ok := s.Get("version"); ok && s.Reply == "!re" {
+			version = v
+			break
+		}
+	}
+
+	if version == "" {
+		return errAPIVersion
+	}
+
+	major, err := rosMajorVersion(version)
+	if err != nil {
+		return err
+	}
+
+	if major < 7 {
+		return fmt.Errorf("RouterOS 7 required by the default command, found %s. Set `commands' for older versions", version)
+	}
+
+	return nil
+}
+
+func (a *API) Export(ctx context.Context) (response io.ReadCloser, metadata Metadata, err error) {
+	port := a.Port
+	if port == "" {
+		if a.Config.TLSConfig != nil {
+			port = "8729"
+		} else {
+			port = "8728"
+		}
+	}
+
+	address := net.JoinHostPort(a.Host, port)
+
+	l := a.Logger.WithFields(logrus.Fields{
+		"name":    a.Name,
+		"address": address,
+	})
+
+	l.Info("establishing API connection...")
+
+	client, err := rosapi.Dial(ctx, address, &a.Config)
+	if err != nil {
+		return nil, a.ExportMetadata, fmt.Errorf("api: %v", err)
+	}
+	defer client.Close()
+
+	if d, ok := ctx.Deadline(); ok {
+		client.SetDeadline(d)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			client.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	commands := a.Commands
+	if len(commands) == 0 {
+		l.Info("checking RouterOS version...")
+
+		if err := checkDefaultAPICommand(client); err != nil {
+			if e := ctx.Err(); e != nil {
+				err = e
+			}
+			return nil, a.ExportMetadata, fmt.Errorf("api: %v", err)
+		}
+
+		commands = [][]string{defaultAPICommand}
+	}
+
+	var buf bytes.Buffer
+
+	for _, cmd := range commands {
+		command := strings.Join(cmd, " ")
+		l.Infof("issuing `%s' command...", command)
+
+		res, err := client.Run(cmd...)
+		if err != nil {
+			if e := ctx.Err(); e != nil {
+				err = e
+			}
+			return nil, a.ExportMetadata, fmt.Errorf("api: %s: %v", command, err)
+		}
+
+		if len(commands) > 1 {
+			fmt.Fprintf(&buf, "# %s\n", command)
+		}
+
+		if err := writeAPIReply(&buf, res); err != nil {
+			return nil, a.ExportMetadata, err
+		}
+	}
+
+	return ioutil.NopCloser(&buf), a.ExportMetadata, nil
+}
+
+func (a *API) Metadata() Metadata {
+	return a.DeviceMetadata
+}
+
+func newAPI(options config.Options, logger *logrus.Logger) (Exporter, error) {
+	a := API{
+		Logger: logger,
+	}
+
+	a.Name, _ = options.GetString("name")
+	a.Host, _ = options.GetString("host")
+	a.Port, _ = options.GetString("port")
+	a.Config.Username, _ = options.GetString("username")
+	a.Config.Password, _ = options.GetString("password")
+
+	if a.Host == "" {
+		return nil, errors.New("api: address missing")
+	}
+
+	if a.Config.Username == "" {
+		return nil, errors.New("api: user name missing")
+	}
+
+	if useTLS, _ := options.GetBool("tls"); useTLS {
+		conf, err := newTLSConfig(options)
+		if err != nil {
+			return nil, fmt.Errorf("api: %v", err)
+		}
+		a.Config.TLSConfig = conf
+	}
+
+	// Each command is either a list of API words or a string split before attribute and query words
+	if val, ok := options["commands"]; ok {
+		list, ok := val.([]interface{})
+		if !ok {
+			list = []interface{}{val}
+		}
+
+		for _, v := range list {
+			var words []string
+
+			switch vv := v.(type) {
+			case string:
+				words = splitAPIWords(vv)
+			case []interface{}:
+				for _, w := range vv {
+					words = append(words, fmt.Sprintf("%v", w))
+				}
+			}
+
+			if len(words) == 0 {
+				return nil, errors.New("api: empty command")
+			}
+
+			a.Commands = append(a.Commands, words)
+		}
+	}
+
+	// Filter out password
+	metadata := make(Metadata, len(options))
+	for k, v := range options {
+		if k != "password" {
+			metadata[k] = v
+		}
+	}
+
+	a.ExportMetadata = metadata
+	a.DeviceMetadata = Metadata{
+		"name":   a.Name,
+		"host":   a.Host,
+		"device": "api",
+	}
+
+	return &a, nil
+}
+
+func init() {
+	registerExporter("api", newAPI)
+}
@@ -0,0 +1,189 @@
+package devices
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// apiTestExchange is a command expected by the fake device and its replies. Only words shorter than 128 bytes are supported
+type apiTestExchange struct {
+	command []string
+	replies [][]string
+}
+
+func writeAPIWords(w io.Writer, words []string) error {
+	var buf []byte
+	for _, word := range words {
+		buf = append(buf, byte(len(word)))
+		buf = append(buf, word...)
+	}
+	_, err := w.Write(append(buf, 0))
+	return err
+}
+
+func readAPIWords(rd *bufio.Reader) ([]string, error) {
+	var words []string
+	for {
+		l, err := rd.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		if l == 0 {
+			return words, nil
+		}
+
+		if l >= 0x80 {
+			return nil, errors.New("word is too long")
+		}
+
+		buf := make([]byte, l)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		words = append(words, string(buf))
+	}
+}
+
+func TestROSMajorVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		major   int
+		err     bool
+	}{
+		{version: "7.14.3 (stable)", major: 7},
+		{version: "6.49.10 (long-term)", major: 6},
+		{version: "7.1rc1 (testing)", major: 7},
+		{version: "stable", err: true},
+		{version: "x.1", err: true},
+	}
+
+	for _, test := range tests {
+		major, err := rosMajorVersion(test.version)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error", test.version)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", test.version, err)
+		} else if major != test.major {
+			t.Errorf("%s: got %d, expected %d", test.version, major, test.major)
+		}
+	}
+}
+
+func TestAPIDefaultCommand(t *testing.T) {
+	done := [][]string{{"!done"}}
+
+	tests := []struct {
+		name    string
+		version [][]string
+		output  string
+		err     string
+	}{
+		{
+			name:    "RouterOS 7",
+			version: [][]string{{"!re", "=version=7.14.3 (stable)"}, {"!done"}},
+			output:  "/system identity\nset name=r1\n",
+		},
+		{
+			name:    "RouterOS 6",
+			version: [][]string{{"!re", "=version=6.49.10 (long-term)"}, {"!done"}},
+			err:     "api: RouterOS 7 required by the default command, found 6.49.10 (long-term). Set `commands' for older versions",
+		},
+		{
+			name:    "no version",
+			version: done,
+			err:     "api: can't get RouterOS version",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+
+			exchanges := []apiTestExchange{
+				{command: []string{"/login", "=name=admin", "=password=secret"}, replies: done},
+				{command: []string{"/system/resource/print", "=.proplist=version"}, replies: test.version},
+			}
+			if test.output != "" {
+				exchanges = append(exchanges, apiTestExchange{command: defaultAPICommand, replies: [][]string{{"!done", "=ret=" + test.output}}})
+			}
+
+			srvErr := make(chan error, 1)
+			go func() {
+				conn, err := l.Accept()
+				if err != nil {
+					srvErr <- err
+					return
+				}
+				defer conn.Close()
+
+				rd := bufio.NewReader(conn)
+				for _, ex := range exchanges {
+					cmd, err := readAPIWords(rd)
+					if err != nil {
+						srvErr <- err
+						return
+					}
+
+					if !reflect.DeepEqual(cmd, ex.command) {
+						srvErr <- errors.New("unexpected command: " + cmd[0])
+						return
+					}
+
+					for _, r := range ex.replies {
+						if err := writeAPIWords(conn, r); err != nil {
+							srvErr <- err
+							return
+						}
+					}
+				}
+				srvErr <- nil
+			}()
+
+			host, port, _ := net.SplitHostPort(l.Addr().String())
+			a := API{
+				Host:   host,
+				Port:   port,
+				Logger: newTestLogger(),
+			}
+			a.Config.Username = "admin"
+			a.Config.Password = "secret"
+
+			r, _, err := a.Export(context.Background())
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Errorf("got error %v, expected %s", err, test.err)
+				}
+			} else if err != nil {
+				t.Error(err)
+			} else {
+				data, err := ioutil.ReadAll(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != test.output {
+					t.Errorf("got %q, expected %q", data, test.output)
+				}
+			}
+
+			if err := <-srvErr; err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
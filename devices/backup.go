@@ -0,0 +1,160 @@
+package devices
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ecadlabs/rosdump/config"
+	"github.com/ecadlabs/rosdump/sshutils"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultBackupName = "rosdump"
+
+var rosQuoteReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`)
+
+// quoteROS returns the value as RouterOS CLI double quoted string
+func quoteROS(s string) string {
+	return "\"" + rosQuoteReplacer.Replace(s) + "\""
+}
+
+// Backup saves binary backup on the device and downloads it using SCP
+type Backup struct {
+	*SSHDevice
+	BackupName     string
+	BackupPassword string
+}
+
+type backupResponse struct {
+	io.ReadCloser
+	b    *Backup
+	conn *sshConn
+	file string
+}
+
+func (b *backupResponse) Close() (err error) {
+	defer func() {
+		if e := b.conn.Close(); err == nil {
+			err = e
+		}
+	}()
+
+	// The file is removed even if the transfer failed
+	cerr := b.ReadCloser.Close()
+	rerr := b.b.remove(b.conn, b.file)
+
+	switch {
+	case cerr != nil && rerr != nil:
+		return fmt.Errorf("backup: %v; %v", cerr, rerr)
+	case cerr != nil:
+		return fmt.Errorf("backup: %v", cerr)
+	}
+
+	return rerr
+}
+
+func (b *Backup) remove(conn *sshConn, file string) error {
+	b.logger().Infof("removing `%s'...", file)
+
+	out, err := sshutils.Output(conn.ctx, conn.Client.Client, "/file remove "+quoteROS(file))
+	if err != nil {
+		return fmt.Errorf("backup: remove: %v", err)
+	}
+
+	if msg := strings.TrimSpace(string(out)); msg != "" {
+		return fmt.Errorf("backup: remove: %s", msg)
+	}
+
+	return nil
+}
+
+func (b *Backup) Export(ctx context.Context) (response io.ReadCloser, metadata Metadata, err error) {
+	name := b.BackupName
+	if name == "" {
+		name = defaultBackupName
+	}
+
+	file := name + ".backup"
+	l := b.logger()
+
+	conn, err := b.connect(ctx)
+	if err != nil {
+		return nil, b.ExportMetadata, fmt.Errorf("backup: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
+
+	metadata, err = b.exportMetadata(conn)
+	if err != nil {
+		return nil, metadata, fmt.Errorf("backup: %v", err)
+	}
+
+	command := "/system backup save name=" + quoteROS(name)
+	if b.BackupPassword != "" {
+		command += " password=" + quoteROS(b.BackupPassword)
+	}
+
+	l.Info("saving backup...")
+
+	out, err := sshutils.Output(ctx, conn.Client.Client, command)
+	if err != nil {
+		return nil, metadata, fmt.Errorf("backup: save: %v", err)
+	}
+
+	if msg := strings.TrimSpace(string(out)); !strings.Contains(msg, "saved") {
+		return nil, metadata, fmt.Errorf("backup: save: %s", msg)
+	}
+
+	l.Infof("downloading `%s'...", file)
+
+	_, rd, err := sshutils.SCPGet(ctx, conn.Client.Client, file)
+	if err != nil {
+		if e := b.remove(conn, file); e != nil {
+			l.Error(e)
+		}
+		return nil, metadata, fmt.Errorf("backup: %v", err)
+	}
+
+	res := backupResponse{
+		ReadCloser: rd,
+		b:          b,
+		conn:       conn,
+		file:       file,
+	}
+
+	return &res, metadata, nil
+}
+
+func newBackup(options config.Options, logger *logrus.Logger) (Exporter, error) {
+	dev, err := newSSHDevice("backup", options, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// Filter out backup password
+	delete(dev.ExportMetadata, "backup_password")
+
+	b := Backup{
+		SSHDevice: dev,
+	}
+
+	b.BackupName, _ = options.GetString("backup_name")
+	if b.BackupName != "" {
+		if err := sshutils.CheckSCPName(b.BackupName + ".backup"); err != nil {
+			return nil, fmt.Errorf("backup: %v", err)
+		}
+	}
+	b.BackupPassword, _ = options.GetString("backup_password")
+
+	return &b, nil
+}
+
+func init() {
+	registerExporter("backup", newBackup)
+}
@@ -0,0 +1,272 @@
+package devices
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/ecadlabs/rosdump/config"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	execEnvPrefix = "ROSDUMP_"
+	maxExecStderr = 4096
+)
+
+// Exec runs a local program and exports its standard output
+type Exec struct {
+	Name    string
+	Host    string
+	Command string
+	// Argument templates expanded with export metadata
+	Args []*template.Template
+	// Working directory
+	Dir string
+	// Additional environment variables
+	Env            []string
+	Logger         *logrus.Logger
+	ExportMetadata Metadata
+	DeviceMetadata Metadata
+}
+
+func (e *Exec) logger() *logrus.Entry {
+	return e.Logger.WithFields(logrus.Fields{
+		"name":    e.Name,
+		"command": e.Command,
+	})
+}
+
+// limitedBuffer keeps the beginning of the data
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	if n := l.limit - l.Len(); n > 0 {
+		if len(p) > n {
+			l.Buffer.Write(p[:n])
+		} else {
+			l.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// envName converts metadata key to an environment variable name i.e. `identity_file' -> `ROSDUMP_IDENTITY_FILE'
+func envName(key string) string {
+	return execEnvPrefix + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// metadataEnv passes scalar metadata values as environment variables
+func metadataEnv(metadata Metadata) []string {
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var env []string
+	for _, k := range keys {
+		switch v := metadata[k].(type) {
+		case nil, []interface{}, map[interface{}]interface{}, map[string]interface{}:
+		default:
+			env = append(env, envName(k)+"="+fmt.Sprintf("%v", v))
+		}
+	}
+
+	return env
+}
+
+type execResponse struct {
+	ctx    context.Context
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr *limitedBuffer
+	// Closed when the command exits
+	exited chan struct{}
+	done   bool
+	err    error
+}
+
+func (e *execResponse) wait() error {
+	if e.done {
+		return e.err
+	}
+	e.done = true
+
+	err := e.cmd.Wait()
+	close(e.exited)
+
+	// The output may be cut short by killed children even if the command itself succeeded
+	if e.ctx.Err() != nil {
+		e.err = fmt.Errorf("exec: %v", e.ctx.Err())
+	} else if err != nil {
+		if msg := strings.TrimSpace(e.stderr.String()); msg != "" {
+			e.err = fmt.Errorf("exec: %v: %s", err, msg)
+		} else {
+			e.err = fmt.Errorf("exec: %v", err)
+		}
+	}
+
+	return e.err
+}
+
+// Read reports non-zero exit status instead of EOF so the export fails
+func (e *execResponse) Read(p []byte) (int, error) {
+	n, err := e.stdout.Read(p)
+	if err == io.EOF {
+		if e := e.wait(); e != nil {
+			err = e
+		}
+	}
+	return n, err
+}
+
+func (e *execResponse) Close() error {
+	if !e.done {
+		// Output isn't needed anymore
+		killProcessGroup(e.cmd)
+	}
+	return e.wait()
+}
+
+func (e *Exec) Export(ctx context.Context) (io.ReadCloser, Metadata, error) {
+	args := make([]string, len(e.Args))
+	for i, tpl := range e.Args {
+		var s strings.Builder
+		if err := tpl.Execute(&s, e.ExportMetadata); err != nil {
+			return nil, e.ExportMetadata, fmt.Errorf("exec: %v", err)
+		}
+		args[i] = s.String()
+	}
+
+	cmd := exec.Command(e.Command, args...)
+	setProcessGroup(cmd)
+	cmd.Dir = e.Dir
+	cmd.Env = append(append(os.Environ(), metadataEnv(e.ExportMetadata)...), e.Env...)
+
+	stderr := limitedBuffer{limit: maxExecStderr}
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, e.ExportMetadata, fmt.Errorf("exec: %v", err)
+	}
+
+	e.logger().Info("starting...")
+
+	if err := cmd.Start(); err != nil {
+		return nil, e.ExportMetadata, fmt.Errorf("exec: %v", err)
+	}
+
+	res := execResponse{
+		ctx:    ctx,
+		cmd:    cmd,
+		stdout: stdout,
+		stderr: &stderr,
+		exited: make(chan struct{}),
+	}
+
+	// exec.CommandContext kills the command only, children would keep the output open
+	go func() {
+		select {
+		case <-ctx.Done():
+			killProcessGroup(cmd)
+		case <-res.exited:
+		}
+	}()
+
+	return &res, e.ExportMetadata, nil
+}
+
+func (e *Exec) Metadata() Metadata {
+	return e.DeviceMetadata
+}
+
+func newExec(options config.Options, logger *logrus.Logger) (Exporter, error) {
+	e := Exec{
+		Logger: logger,
+	}
+
+	e.Name, _ = options.GetString("name")
+	e.Host, _ = options.GetString("host")
+	e.Command, _ = options.GetString("command")
+	e.Dir, _ = options.GetString("dir")
+
+	if e.Command == "" {
+		return nil, errors.New("exec: command missing")
+	}
+
+	var args []interface{}
+	switch v := options["args"].(type) {
+	case string:
+		args = []interface{}{v}
+	case []interface{}:
+		args = v
+	}
+
+	for i, v := range args {
+		tpl, err := template.New("arg").Parse(fmt.Sprintf("%v", v))
+		if err != nil {
+			return nil, fmt.Errorf("exec: argument %d: %v", i, err)
+		}
+		e.Args = append(e.Args, tpl)
+	}
+
+	if v, ok := options["env"]; ok {
+		m, ok := v.(map[interface{}]interface{})
+		if !ok {
+			return nil, errors.New("exec: env must be a map")
+		}
+
+		env := mapOptions(m)
+		keys := make([]string, 0, len(env))
+		for k := range env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			val, _ := env.GetString(k)
+			e.Env = append(e.Env, k+"="+val)
+		}
+	}
+
+	// Filter out password
+	metadata := make(Metadata, len(options))
+	for k, v := range options {
+		if k != "password" {
+			metadata[k] = v
+		}
+	}
+
+	e.ExportMetadata = metadata
+	e.DeviceMetadata = Metadata{
+		"name":   e.Name,
+		"host":   e.Host,
+		"device": "exec",
+	}
+
+	return &e, nil
+}
+
+func init() {
+	registerExporter("exec", newExec)
+}
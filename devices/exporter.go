@@ -30,6 +30,71 @@ type Exporter interface {
 	Metadata() Metadata // For logging purposes
 }
 
+// ArtifactReader returns named streams one by one
+type ArtifactReader interface {
+	// Next returns the next artifact or io.EOF after the last one. Artifact name is returned along with an error
+	// if the artifact can't be exported. Previous artifact must be closed before calling Next again.
+	Next() (string, io.ReadCloser, error)
+	Close() error
+}
+
+// MultiExporter is implemented by exporters producing several named streams (artifacts) per run
+type MultiExporter interface {
+	Exporter
+	ExportArtifacts(context.Context) (ArtifactReader, Metadata, error)
+}
+
+type concatReader struct {
+	ar  ArtifactReader
+	cur io.ReadCloser
+	err error
+}
+
+func (c *concatReader) Read(p []byte) (int, error) {
+	for c.err == nil {
+		if c.cur == nil {
+			if _, c.cur, c.err = c.ar.Next(); c.err != nil {
+				break
+			}
+		}
+
+		n, err := c.cur.Read(p)
+		if err == io.EOF {
+			err = c.cur.Close()
+			c.cur = nil
+			if n == 0 && err == nil {
+				continue
+			}
+		}
+
+		if err != nil {
+			c.err = err
+		}
+
+		return n, err
+	}
+
+	return 0, c.err
+}
+
+func (c *concatReader) Close() error {
+	var err error
+	if c.cur != nil {
+		err = c.cur.Close()
+	}
+
+	if e := c.ar.Close(); err == nil {
+		err = e
+	}
+
+	return err
+}
+
+// concatArtifacts returns a stream of all artifacts one after another
+func concatArtifacts(ar ArtifactReader) io.ReadCloser {
+	return &concatReader{ar: ar}
+}
+
 type NewExporterFunc func(config.Options, *logrus.Logger) (Exporter, error)
 
 var registry = make(map[string]NewExporterFunc)
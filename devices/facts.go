@@ -0,0 +1,121 @@
+package devices
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/ecadlabs/rosdump/sshutils"
+)
+
+type factsCommand struct {
+	command string
+	// RouterOS property -> metadata key
+	keys map[string]string
+}
+
+var factsCommands = []*factsCommand{
+	{
+		command: "/system identity print",
+		keys: map[string]string{
+			"name": "identity",
+		},
+	},
+	{
+		command: "/system resource print",
+		keys: map[string]string{
+			"version":           "version",
+			"board-name":        "board_name",
+			"architecture-name": "architecture",
+		},
+	},
+	{
+		command: "/system routerboard print",
+		keys: map[string]string{
+			"model":            "model",
+			"serial-number":    "serial_number",
+			"current-firmware": "firmware",
+		},
+	},
+}
+
+// parsePrintOutput parses `key: value' lines of a print command
+func parsePrintOutput(out []byte) map[string]string {
+	res := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(out))
+
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			continue
+		}
+
+		key := strings.TrimSpace(line[:i])
+		if strings.ContainsAny(key, " \t") {
+			continue
+		}
+
+		res[key] = strings.Trim(strings.TrimSpace(line[i+1:]), "\"")
+	}
+
+	return res
+}
+
+// collectFacts runs print commands over the connection and returns parsed device properties
+func (s *SSHDevice) collectFacts(conn *sshConn) (Metadata, error) {
+	s.logger().Info("collecting device facts...")
+
+	facts := make(Metadata)
+
+	for _, c := range factsCommands {
+		out, err := sshutils.Output(conn.ctx, conn.Client.Client, c.command)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", c.command, err)
+		}
+
+		props := parsePrintOutput(out)
+		for prop, key := range c.keys {
+			if v, ok := props[prop]; ok {
+				facts[key] = v
+			}
+		}
+	}
+
+	return facts, nil
+}
+
+// exportMetadata returns export metadata extended with connection details and optionally device facts
+func (s *SSHDevice) exportMetadata(conn *sshConn) (Metadata, error) {
+	metadata := s.ExportMetadata
+
+	// Record accepted credential set
+	if cred := conn.Credentials; cred.Name != "" {
+		metadata = metadata.Append(Metadata{
+			"credentials": cred.Name,
+			"username":    cred.Username,
+		})
+	}
+
+	if n := conn.Negotiated; n != nil {
+		metadata = metadata.Append(Metadata{
+			"ssh_kex":      n.KeyExchange,
+			"ssh_host_key": n.HostKey,
+			"ssh_cipher":   n.Cipher,
+			"ssh_mac":      n.MAC,
+		})
+	}
+
+	if !s.Facts {
+		return metadata, nil
+	}
+
+	facts, err := s.collectFacts(conn)
+	if err != nil {
+		return metadata, err
+	}
+
+	return metadata.Append(facts), nil
+}
@@ -0,0 +1,285 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/ecadlabs/rosdump/config"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	httpMaxErrorBody   = 4096
+	defaultHTTPMaxSize = 64 << 20
+)
+
+// HTTP downloads the configuration from a URL
+type HTTP struct {
+	Name string
+	// URL and body templates expanded with export metadata
+	URL    *template.Template
+	Method string
+	Body   *template.Template
+	Header http.Header
+	// Basic authentication is used if set
+	Username string
+	Password string
+	// Bearer token
+	Token string
+	// Response body size limit
+	MaxSize        int64
+	Client         *http.Client
+	Logger         *logrus.Logger
+	ExportMetadata Metadata
+	DeviceMetadata Metadata
+}
+
+// limitedBody fails instead of truncating the response
+type limitedBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		// Check if there is anything left
+		var b [1]byte
+		n, err := l.ReadCloser.Read(b[:])
+		if n != 0 {
+			return 0, errors.New("http: response body size limit exceeded")
+		}
+		return 0, err
+	}
+
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+
+	n, err := l.ReadCloser.Read(p)
+	l.n -= int64(n)
+
+	return n, err
+}
+
+func (h *HTTP) expand(tpl *template.Template) (string, error) {
+	var s strings.Builder
+	if err := tpl.Execute(&s, h.ExportMetadata); err != nil {
+		return "", err
+	}
+	return s.String(), nil
+}
+
+func (h *HTTP) Export(ctx context.Context) (response io.ReadCloser, metadata Metadata, err error) {
+	u, err := h.expand(h.URL)
+	if err != nil {
+		return nil, h.ExportMetadata, fmt.Errorf("http: url: %v", err)
+	}
+
+	var body io.Reader
+	if h.Body != nil {
+		b, err := h.expand(h.Body)
+		if err != nil {
+			return nil, h.ExportMetadata, fmt.Errorf("http: body: %v", err)
+		}
+		body = strings.NewReader(b)
+	}
+
+	req, err := http.NewRequest(h.Method, u, body)
+	if err != nil {
+		return nil, h.ExportMetadata, fmt.Errorf("http: %v", err)
+	}
+
+	req = req.WithContext(ctx)
+	for k, v := range h.Header {
+		req.Header[k] = v
+	}
+
+	switch {
+	case h.Token != "":
+		req.Header.Set("Authorization", "Bearer "+h.Token)
+	case h.Username != "":
+		req.SetBasicAuth(h.Username, h.Password)
+	}
+
+	// Don't log credentials
+	logURL := *req.URL
+	logURL.User = nil
+
+	l := h.Logger.WithFields(logrus.Fields{
+		"name": h.Name,
+		"url":  logURL.String(),
+	})
+
+	l.Infof("sending %s request...", h.Method)
+
+	res, err := h.Client.Do(req)
+	if err != nil {
+		return nil, h.ExportMetadata, fmt.Errorf("http: %v", err)
+	}
+
+	if res.StatusCode/100 != 2 {
+		defer res.Body.Close()
+
+		buf, _ := ioutil.ReadAll(io.LimitReader(res.Body, httpMaxErrorBody))
+		if msg := strings.TrimSpace(string(buf)); msg != "" {
+			return nil, h.ExportMetadata, fmt.Errorf("http: %s: %s", res.Status, msg)
+		}
+
+		return nil, h.ExportMetadata, fmt.Errorf("http: %s", res.Status)
+	}
+
+	if res.ContentLength > h.MaxSize {
+		res.Body.Close()
+		return nil, h.ExportMetadata, fmt.Errorf("http: response body size %d exceeds limit %d", res.ContentLength, h.MaxSize)
+	}
+
+	return &limitedBody{
+		ReadCloser: res.Body,
+		n:          h.MaxSize,
+	}, h.ExportMetadata, nil
+}
+
+func (h *HTTP) Metadata() Metadata {
+	return h.DeviceMetadata
+}
+
+func newHTTP(options config.Options, logger *logrus.Logger) (Exporter, error) {
+	h := HTTP{
+		Header:  make(http.Header),
+		MaxSize: defaultHTTPMaxSize,
+		Logger:  logger,
+	}
+
+	h.Name, _ = options.GetString("name")
+	h.Username, _ = options.GetString("username")
+	h.Password, _ = options.GetString("password")
+	h.Method, _ = options.GetString("method")
+
+	var err error
+	if h.Token, err = options.GetSecret("token"); err != nil && err != config.ErrOptNotFound {
+		return nil, fmt.Errorf("http: %v", err)
+	}
+
+	rawURL, _ := options.GetString("url")
+	if rawURL == "" {
+		return nil, errors.New("http: url missing")
+	}
+
+	if h.URL, err = template.New("url").Parse(rawURL); err != nil {
+		return nil, fmt.Errorf("http: url: %v", err)
+	}
+
+	h.Method = strings.ToUpper(h.Method)
+	switch h.Method {
+	case "":
+		h.Method = http.MethodGet
+	case http.MethodGet, http.MethodPost:
+	default:
+		return nil, fmt.Errorf("http: unsupported method: `%s'", h.Method)
+	}
+
+	if b, ok := options["body"]; ok {
+		if h.Method != http.MethodPost {
+			return nil, errors.New("http: body requires POST method")
+		}
+
+		if h.Body, err = template.New("body").Parse(fmt.Sprintf("%v", b)); err != nil {
+			return nil, fmt.Errorf("http: body: %v", err)
+		}
+	}
+
+	if v, ok := options["headers"]; ok {
+		m, ok := v.(map[interface{}]interface{})
+		if !ok {
+			return nil, errors.New("http: headers must be a map")
+		}
+
+		headers := mapOptions(m)
+		keys := make([]string, 0, len(headers))
+		for k := range headers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			val, _ := headers.GetString(k)
+			h.Header.Add(k, val)
+		}
+	}
+
+	if ct, _ := options.GetString("content_type"); ct != "" {
+		h.Header.Set("Content-Type", ct)
+	}
+
+	if _, ok := options["max_size"]; ok {
+		if h.MaxSize, err = options.GetInt("max_size"); err != nil {
+			return nil, fmt.Errorf("http: max_size: %v", err)
+		}
+		if h.MaxSize <= 0 {
+			return nil, errors.New("http: max_size must be positive")
+		}
+	}
+
+	tlsConfig, err := newTLSConfig(options)
+	if err != nil {
+		return nil, fmt.Errorf("http: %v", err)
+	}
+
+	transport := http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}
+
+	dialer, err := newDialer(options)
+	if err != nil {
+		return nil, fmt.Errorf("http: %v", err)
+	}
+
+	// Explicit proxy or source address take precedence over the environment
+	if dialer != nil {
+		transport.Proxy = nil
+		transport.DialContext = dialer.DialContext
+	}
+
+	h.Client = &http.Client{
+		Transport: &transport,
+	}
+
+	host, _ := options.GetString("host")
+	if host == "" {
+		// Best effort, the template may produce the host
+		if u, err := url.Parse(rawURL); err == nil {
+			host = u.Hostname()
+		}
+	}
+
+	// Filter out secrets
+	metadata := make(Metadata, len(options))
+	for k, v := range options {
+		if k != "password" && k != "token" {
+			metadata[k] = v
+		}
+	}
+	stripProxyCredentials(metadata)
+
+	h.ExportMetadata = metadata
+	h.DeviceMetadata = Metadata{
+		"name":   h.Name,
+		"host":   host,
+		"device": "http",
+	}
+
+	return &h, nil
+}
+
+func init() {
+	registerExporter("http", newHTTP)
+}
@@ -0,0 +1,318 @@
+package devices
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ecadlabs/rosdump/config"
+	"github.com/ecadlabs/rosdump/sshutils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	netconfNamespace = "urn:ietf:params:xml:ns:netconf:base:1.0"
+	netconfBase10    = "urn:ietf:params:netconf:base:1.0"
+	netconfBase11    = "urn:ietf:params:netconf:base:1.1"
+	netconfEOM       = "]]>]]>"
+
+	defaultNetconfDatastore = "running"
+	defaultNetconfPort      = "830"
+)
+
+var netconfHello = xml.Header + `<hello xmlns="` + netconfNamespace + `"><capabilities>` +
+	`<capability>` + netconfBase10 + `</capability>` +
+	`<capability>` + netconfBase11 + `</capability>` +
+	`</capabilities></hello>`
+
+// Netconf exports the configuration using NETCONF over SSH (RFC 6242)
+type Netconf struct {
+	*SSHDevice
+	// Datastore name i.e. `running' or `candidate'
+	Datastore string
+	// Optional subtree filter
+	Filter string
+}
+
+// netconfSession implements both end-of-message and chunked framing
+type netconfSession struct {
+	rd      *bufio.Reader
+	wr      io.Writer
+	chunked bool
+}
+
+func (n *netconfSession) readEOM() ([]byte, error) {
+	var buf bytes.Buffer
+	for {
+		data, err := n.rd.ReadSlice('>')
+		buf.Write(data)
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if bytes.HasSuffix(buf.Bytes(), []byte(netconfEOM)) {
+			return buf.Bytes()[:buf.Len()-len(netconfEOM)], nil
+		}
+	}
+}
+
+func (n *netconfSession) readChunked() ([]byte, error) {
+	var buf bytes.Buffer
+	for {
+		var hdr [2]byte
+		if _, err := io.ReadFull(n.rd, hdr[:]); err != nil {
+			return nil, err
+		}
+
+		if hdr != [2]byte{'\n', '#'} {
+			return nil, errors.New("invalid chunk header")
+		}
+
+		line, err := n.rd.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "#" {
+			return buf.Bytes(), nil
+		}
+
+		size, err := strconv.ParseUint(line, 10, 32)
+		if err != nil || size == 0 {
+			return nil, fmt.Errorf("invalid chunk size: %s", line)
+		}
+
+		if _, err := io.CopyN(&buf, n.rd, int64(size)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (n *netconfSession) read() ([]byte, error) {
+	if n.chunked {
+		return n.readChunked()
+	}
+	return n.readEOM()
+}
+
+func (n *netconfSession) write(msg string) (err error) {
+	if n.chunked {
+		_, err = fmt.Fprintf(n.wr, "\n#%d\n%s\n##\n", len(msg), msg)
+	} else {
+		_, err = io.WriteString(n.wr, msg+netconfEOM)
+	}
+	return
+}
+
+// hello exchanges capabilities and selects the framing
+func (n *netconfSession) hello() error {
+	if err := n.write(netconfHello); err != nil {
+		return err
+	}
+
+	msg, err := n.read()
+	if err != nil {
+		return err
+	}
+
+	var hello struct {
+		Capabilities []string `xml:"capabilities>capability"`
+	}
+
+	if err := xml.Unmarshal(msg, &hello); err != nil {
+		return fmt.Errorf("hello: %v", err)
+	}
+
+	var base10 bool
+	for _, c := range hello.Capabilities {
+		switch strings.TrimSpace(c) {
+		case netconfBase11:
+			n.chunked = true
+		case netconfBase10:
+			base10 = true
+		}
+	}
+
+	if !n.chunked && !base10 {
+		return errors.New("hello: no common base capability")
+	}
+
+	return nil
+}
+
+// rpc sends the request and returns the parsed reply
+func (n *netconfSession) rpc(id int, body string) (*xmlNode, error) {
+	msg := fmt.Sprintf(`%s<rpc message-id="%d" xmlns="%s">%s</rpc>`, xml.Header, id, netconfNamespace, body)
+	if err := n.write(msg); err != nil {
+		return nil, err
+	}
+
+	data, err := n.read()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := parseXML(data)
+	if err != nil {
+		return nil, fmt.Errorf("rpc-reply: %v", err)
+	}
+
+	if reply.Name.Local != "rpc-reply" {
+		return nil, fmt.Errorf("unexpected message: %s", reply.Name.Local)
+	}
+
+	for _, c := range reply.Children {
+		if c.Name.Local != "rpc-error" {
+			continue
+		}
+
+		// Warnings don't fail the request
+		if sev := c.child("error-severity"); sev != nil && strings.TrimSpace(sev.text()) == "warning" {
+			continue
+		}
+
+		if m := c.child("error-message"); m != nil {
+			return nil, fmt.Errorf("rpc-error: %s", strings.TrimSpace(m.text()))
+		}
+
+		if t := c.child("error-tag"); t != nil {
+			return nil, fmt.Errorf("rpc-error: %s", strings.TrimSpace(t.text()))
+		}
+
+		return nil, errors.New("rpc-error")
+	}
+
+	return reply, nil
+}
+
+func (n *Netconf) getConfig(ctx context.Context, conn *sshConn) ([]byte, error) {
+	session, err := sshutils.NewSession(ctx, conn.Client.Client)
+	if err != nil {
+		return nil, fmt.Errorf("new session: %v", err)
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := session.RequestSubsystem("netconf"); err != nil {
+		return nil, fmt.Errorf("netconf subsystem: %v", err)
+	}
+
+	nc := netconfSession{
+		rd: bufio.NewReader(stdout),
+		wr: stdin,
+	}
+
+	if err := nc.hello(); err != nil {
+		return nil, err
+	}
+
+	body := "<get-config><source><" + n.Datastore + "/></source>"
+	if n.Filter != "" {
+		body += `<filter type="subtree">` + n.Filter + "</filter>"
+	}
+	body += "</get-config>"
+
+	n.logger().Infof("requesting `%s' datastore...", n.Datastore)
+
+	reply, err := nc.rpc(1, body)
+	if err != nil {
+		return nil, err
+	}
+
+	data := reply.child("data")
+	if data == nil {
+		return nil, errors.New("rpc-reply: data missing")
+	}
+	data.inheritNamespaces(reply)
+
+	// Best effort
+	if _, err := nc.rpc(2, "<close-session/>"); err != nil {
+		n.logger().Warnln(err)
+	}
+
+	var out bytes.Buffer
+	data.writeCanonical(&out, "")
+
+	return out.Bytes(), nil
+}
+
+func (n *Netconf) Export(ctx context.Context) (response io.ReadCloser, metadata Metadata, err error) {
+	conn, err := n.connect(ctx)
+	if err != nil {
+		return nil, n.ExportMetadata, fmt.Errorf("netconf: %v", err)
+	}
+	defer conn.Close()
+
+	metadata, err = n.exportMetadata(conn)
+	if err != nil {
+		return nil, metadata, fmt.Errorf("netconf: %v", err)
+	}
+
+	out, err := n.getConfig(ctx, conn)
+	if err != nil {
+		return nil, metadata, fmt.Errorf("netconf: %v", err)
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(out)), metadata, nil
+}
+
+var netconfDatastoreRegexp = regexp.MustCompile(`^[A-Za-z_][\w.\-]*$`)
+
+func newNetconf(options config.Options, logger *logrus.Logger) (Exporter, error) {
+	dev, err := newSSHDevice("netconf", options, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if dev.Port == "" {
+		dev.Port = defaultNetconfPort
+	}
+
+	n := Netconf{
+		SSHDevice: dev,
+		Datastore: defaultNetconfDatastore,
+	}
+
+	if ds, _ := options.GetString("datastore"); ds != "" {
+		if !netconfDatastoreRegexp.MatchString(ds) {
+			return nil, fmt.Errorf("netconf: invalid datastore name: `%s'", ds)
+		}
+		n.Datastore = ds
+	}
+
+	n.Filter, _ = options.GetString("filter")
+	if n.Filter != "" {
+		// Must be a well formed fragment
+		if _, err := parseXML([]byte("<filter>" + n.Filter + "</filter>")); err != nil {
+			return nil, fmt.Errorf("netconf: filter: %v", err)
+		}
+	}
+
+	return &n, nil
+}
+
+func init() {
+	registerExporter("netconf", newNetconf)
+}
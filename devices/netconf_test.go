@@ -0,0 +1,224 @@
+package devices
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNetconfRead(t *testing.T) {
+	long := strings.Repeat("<a>x</a>", 64)
+
+	tests := []struct {
+		name     string
+		chunked  bool
+		input    string
+		messages []string
+		err      bool
+	}{
+		{
+			name:     "end of message",
+			input:    "<a/>]]>]]><b>]]>x]]</b>]]>]]>",
+			messages: []string{"<a/>", "<b>]]>x]]</b>"},
+		},
+		{
+			name:     "end of message exceeding buffer",
+			input:    long + "]]>]]>",
+			messages: []string{long},
+		},
+		{
+			name:  "end of message truncated",
+			input: "<a/>]]>]]",
+			err:   true,
+		},
+		{
+			name:     "chunked",
+			chunked:  true,
+			input:    "\n#4\n<rpc\n#3\n/>x\n##\n\n#4\n<a/>\n##\n",
+			messages: []string{"<rpc/>x", "<a/>"},
+		},
+		{
+			name:     "chunk holding a header",
+			chunked:  true,
+			input:    "\n#8\n\n#1\n\n##\n\n##\n",
+			messages: []string{"\n#1\n\n##\n"},
+		},
+		{
+			name:    "invalid chunk header",
+			chunked: true,
+			input:   "#4\n<a/>\n##\n",
+			err:     true,
+		},
+		{
+			name:    "zero chunk size",
+			chunked: true,
+			input:   "\n#0\n\n##\n",
+			err:     true,
+		},
+		{
+			name:    "invalid chunk size",
+			chunked: true,
+			input:   "\n#4a\n<a/>\n##\n",
+			err:     true,
+		},
+		{
+			name:    "truncated chunk",
+			chunked: true,
+			input:   "\n#10\n<a/>",
+			err:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n := netconfSession{
+				rd:      bufio.NewReaderSize(strings.NewReader(test.input), 16),
+				chunked: test.chunked,
+			}
+
+			var messages []string
+			for range test.messages {
+				msg, err := n.read()
+				if err != nil {
+					t.Fatal(err)
+				}
+				messages = append(messages, string(msg))
+			}
+
+			if test.err {
+				if msg, err := n.read(); err == nil {
+					t.Errorf("expected error, got %q", msg)
+				}
+				return
+			}
+
+			if !reflect.DeepEqual(messages, test.messages) {
+				t.Errorf("got %q, expected %q", messages, test.messages)
+			}
+		})
+	}
+}
+
+func TestNetconfWrite(t *testing.T) {
+	for _, chunked := range []bool{false, true} {
+		var buf bytes.Buffer
+		n := netconfSession{wr: &buf, chunked: chunked}
+
+		if err := n.write("<a/>"); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := "<a/>]]>]]>"
+		if chunked {
+			expected = "\n#4\n<a/>\n##\n"
+		}
+
+		if buf.String() != expected {
+			t.Errorf("got %q, expected %q", buf.String(), expected)
+		}
+	}
+}
+
+func TestNetconfSession(t *testing.T) {
+	const reply = `<rpc-reply message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">%s</rpc-reply>`
+
+	tests := []struct {
+		name         string
+		capabilities []string
+		chunked      bool
+		reply        string
+		err          string
+	}{
+		{
+			name:         "base 1.1",
+			capabilities: []string{netconfBase10, netconfBase11},
+			chunked:      true,
+			reply:        "<data><system/></data>",
+		},
+		{
+			name:         "base 1.0",
+			capabilities: []string{" " + netconfBase10 + "\n"},
+			reply:        "<data><system/></data>",
+		},
+		{
+			name:         "no common capability",
+			capabilities: []string{"urn:ietf:params:netconf:capability:writable-running:1.0"},
+			err:          "hello: no common base capability",
+		},
+		{
+			name:         "rpc error",
+			capabilities: []string{netconfBase11},
+			chunked:      true,
+			reply:        "<rpc-error><error-severity>warning</error-severity></rpc-error><rpc-error><error-tag>access-denied</error-tag></rpc-error>",
+			err:          "rpc-error: access-denied",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, s := net.Pipe()
+			defer c.Close()
+
+			done := make(chan error, 1)
+			go func() {
+				defer s.Close()
+
+				// Hello is always sent using end-of-message framing
+				srv := netconfSession{rd: bufio.NewReader(s), wr: s}
+				if _, err := srv.read(); err != nil {
+					done <- err
+					return
+				}
+
+				hello := `<hello xmlns="` + netconfNamespace + `"><capabilities>`
+				for _, c := range test.capabilities {
+					hello += "<capability>" + c + "</capability>"
+				}
+				hello += "</capabilities><session-id>1</session-id></hello>"
+
+				if err := srv.write(hello); err != nil {
+					done <- err
+					return
+				}
+
+				if test.reply == "" {
+					done <- nil
+					return
+				}
+
+				srv.chunked = test.chunked
+				if _, err := srv.read(); err != nil {
+					done <- err
+					return
+				}
+
+				done <- srv.write(fmt.Sprintf(reply, test.reply))
+			}()
+
+			n := netconfSession{rd: bufio.NewReader(c), wr: c}
+			err := n.hello()
+			if err == nil {
+				if n.chunked != test.chunked {
+					t.Errorf("got chunked %t", n.chunked)
+				}
+				_, err = n.rpc(1, "<get-config><source><running/></source></get-config>")
+			}
+
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Errorf("got error %v, expected %s", err, test.err)
+				}
+			} else if err != nil {
+				t.Error(err)
+			}
+
+			if err := <-done; err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package devices
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+// xmlNode is either an element or a text node if Name is empty
+type xmlNode struct {
+	Name     xml.Name
+	Attr     []xml.Attr
+	Children []*xmlNode
+	Text     string
+}
+
+// parseXML builds a tree keeping namespace prefixes as is. Comments, processing instructions and directives are dropped
+func parseXML(data []byte) (*xmlNode, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+
+	var (
+		root  *xmlNode
+		stack []*xmlNode
+	)
+
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := xmlNode{
+				Name: t.Name,
+				Attr: append([]xml.Attr(nil), t.Attr...),
+			}
+
+			if len(stack) != 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, &n)
+			} else if root == nil {
+				root = &n
+			} else {
+				return nil, errors.New("multiple root elements")
+			}
+
+			stack = append(stack, &n)
+
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, errors.New("unexpected end element")
+			}
+			stack = stack[:len(stack)-1]
+
+		case xml.CharData:
+			if len(stack) != 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, &xmlNode{Text: string(t)})
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, errors.New("no root element")
+	}
+
+	if len(stack) != 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return root, nil
+}
+
+func qualifiedName(n xml.Name) string {
+	if n.Space != "" {
+		return n.Space + ":" + n.Local
+	}
+	return n.Local
+}
+
+func isNamespaceAttr(a xml.Attr) bool {
+	return a.Name.Space == "xmlns" || a.Name.Space == "" && a.Name.Local == "xmlns"
+}
+
+// child returns the first child element with the local name
+func (n *xmlNode) child(local string) *xmlNode {
+	for _, c := range n.Children {
+		if c.Name.Local == local {
+			return c
+		}
+	}
+	return nil
+}
+
+// text returns concatenated text content
+func (n *xmlNode) text() string {
+	if n.Name.Local == "" {
+		return n.Text
+	}
+
+	var s strings.Builder
+	for _, c := range n.Children {
+		s.WriteString(c.text())
+	}
+	return s.String()
+}
+
+// inheritNamespaces copies ancestor's namespace declarations not overridden by the element
+func (n *xmlNode) inheritNamespaces(ancestor *xmlNode) {
+	declared := make(map[xml.Name]struct{}, len(n.Attr))
+	for _, a := range n.Attr {
+		declared[a.Name] = struct{}{}
+	}
+
+	for _, a := range ancestor.Attr {
+		if _, ok := declared[a.Name]; !ok && isNamespaceAttr(a) {
+			n.Attr = append(n.Attr, a)
+		}
+	}
+}
+
+var (
+	xmlTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	xmlAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", "\"", "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+// writeCanonical writes the element using canonical XML conventions: sorted attributes with namespace declarations first,
+// double quotes, no self-closing tags and no comments. Whitespace-only text is replaced with indentation
+func (n *xmlNode) writeCanonical(w *bytes.Buffer, indent string) {
+	attr := append([]xml.Attr(nil), n.Attr...)
+	sort.SliceStable(attr, func(i, j int) bool {
+		ni, nj := isNamespaceAttr(attr[i]), isNamespaceAttr(attr[j])
+		if ni != nj {
+			return ni
+		}
+		return qualifiedName(attr[i].Name) < qualifiedName(attr[j].Name)
+	})
+
+	name := qualifiedName(n.Name)
+
+	w.WriteString(indent + "<" + name)
+	for _, a := range attr {
+		w.WriteString(" " + qualifiedName(a.Name) + "=\"" + xmlAttrEscaper.Replace(a.Value) + "\"")
+	}
+	w.WriteString(">")
+
+	// Mixed content is written as is
+	var elements, mixed bool
+	for _, c := range n.Children {
+		if c.Name.Local != "" {
+			elements = true
+		} else if strings.TrimSpace(c.Text) != "" {
+			mixed = true
+		}
+	}
+
+	switch {
+	case mixed || !elements:
+		for _, c := range n.Children {
+			c.writeInline(w)
+		}
+
+	default:
+		w.WriteString("\n")
+		for _, c := range n.Children {
+			if c.Name.Local != "" {
+				c.writeCanonical(w, indent+"  ")
+			}
+		}
+		w.WriteString(indent)
+	}
+
+	w.WriteString("</" + name + ">\n")
+}
+
+func (n *xmlNode) writeInline(w *bytes.Buffer) {
+	if n.Name.Local == "" {
+		w.WriteString(xmlTextEscaper.Replace(n.Text))
+		return
+	}
+
+	var buf bytes.Buffer
+	n.writeCanonical(&buf, "")
+	w.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
@@ -0,0 +1,201 @@
+package devices
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/ecadlabs/rosdump/config"
+)
+
+// Profile holds platform specific commands and output patterns
+type Profile struct {
+	// Command disabling the pager in interactive sessions
+	DisablePaging string
+	// Command showing the configuration
+	Command string
+	// Prompt regular expression
+	Prompt *regexp.Regexp
+	// Output lines matching any of the expressions are removed
+	Strip []*regexp.Regexp
+}
+
+// stripLine reports whether the line must be removed from the output
+func (p *Profile) stripLine(line string) bool {
+	line = strings.TrimRight(line, "\r\n")
+	for _, re := range p.Strip {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// Prompt of Cisco like CLI including configuration modes
+const ciscoPrompt = `(?m)^[\w.\-]+(\(config[^)]*\))?[>#] ?$`
+
+var profiles = map[string]*Profile{
+	"routeros": {
+		Command: "export",
+		Prompt:  regexp.MustCompile(`(?m)^\[[^\]]+\] > ?$`),
+		Strip: []*regexp.Regexp{
+			regexp.MustCompile(`^# \S+ \S+ by RouterOS`),
+		},
+	},
+	"ios": {
+		DisablePaging: "terminal length 0",
+		Command:       "show running-config",
+		Prompt:        regexp.MustCompile(ciscoPrompt),
+		Strip: []*regexp.Regexp{
+			regexp.MustCompile(`^Building configuration\.\.\.$`),
+			regexp.MustCompile(`^Current configuration : \d+ bytes$`),
+			regexp.MustCompile(`^! Last configuration change at `),
+			regexp.MustCompile(`^! NVRAM config last updated at `),
+			regexp.MustCompile(`^ntp clock-period \d+$`),
+		},
+	},
+	"junos": {
+		DisablePaging: "set cli screen-length 0",
+		Command:       "show configuration",
+		Prompt:        regexp.MustCompile(`(?m)^[\w.\-]+@[\w.\-]+[>#%] ?$`),
+		Strip: []*regexp.Regexp{
+			regexp.MustCompile(`^## Last commit: `),
+			regexp.MustCompile(`^## Last changed: `),
+		},
+	},
+	"eos": {
+		DisablePaging: "terminal length 0",
+		Command:       "show running-config",
+		Prompt:        regexp.MustCompile(ciscoPrompt),
+		Strip: []*regexp.Regexp{
+			regexp.MustCompile(`^! Command: show running-config`),
+			regexp.MustCompile(`^! Time: `),
+			regexp.MustCompile(`^! Startup-config last modified at `),
+		},
+	},
+	"aruba": {
+		DisablePaging: "no page",
+		Command:       "show running-config",
+		Prompt:        regexp.MustCompile(ciscoPrompt),
+		Strip: []*regexp.Regexp{
+			regexp.MustCompile(`^Running configuration:$`),
+			regexp.MustCompile(`^Current configuration:$`),
+		},
+	},
+}
+
+// NewProfile creates a profile from options
+func NewProfile(options config.Options) (*Profile, error) {
+	var p Profile
+
+	p.DisablePaging, _ = options.GetString("disable_paging")
+	p.Command, _ = options.GetString("command")
+
+	if p.Command == "" {
+		return nil, errors.New("command missing")
+	}
+
+	var err error
+	if p.Prompt, err = getRegexp(options, "prompt"); err != nil {
+		return nil, err
+	}
+
+	var list []interface{}
+	switch v := options["strip"].(type) {
+	case string:
+		list = []interface{}{v}
+	case []interface{}:
+		list = v
+	}
+
+	for _, v := range list {
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.New("strip: string expected")
+		}
+
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("strip: %v", err)
+		}
+
+		p.Strip = append(p.Strip, re)
+	}
+
+	return &p, nil
+}
+
+// RegisterProfile adds a user defined profile. Built-in profiles may be overridden
+func RegisterProfile(name string, options config.Options) error {
+	p, err := NewProfile(options)
+	if err != nil {
+		return fmt.Errorf("profile %s: %v", name, err)
+	}
+
+	profiles[name] = p
+
+	return nil
+}
+
+// getProfile returns the profile selected by `profile' or `vendor' option. Nil is returned if none is selected
+func getProfile(options config.Options) (*Profile, error) {
+	name, _ := options.GetString("profile")
+	if name == "" {
+		name, _ = options.GetString("vendor")
+	}
+
+	if name == "" {
+		return nil, nil
+	}
+
+	p, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile: `%s'", name)
+	}
+
+	return p, nil
+}
+
+// stripReader removes lines matching the profile patterns from the stream
+type stripReader struct {
+	io.ReadCloser
+	rd      *bufio.Reader
+	profile *Profile
+	buf     []byte
+	err     error
+}
+
+func newStripReader(r io.ReadCloser, p *Profile) io.ReadCloser {
+	if p == nil || len(p.Strip) == 0 {
+		return r
+	}
+
+	return &stripReader{
+		ReadCloser: r,
+		rd:         bufio.NewReader(r),
+		profile:    p,
+	}
+}
+
+func (s *stripReader) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+
+		line, err := s.rd.ReadBytes('\n')
+		s.err = err
+
+		if len(line) != 0 && !s.profile.stripLine(string(line)) {
+			s.buf = line
+		}
+	}
+
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+
+	return n, nil
+}
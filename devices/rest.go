@@ -0,0 +1,264 @@
+package devices
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ecadlabs/rosdump/config"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	restMaxErrorBody  = 4096
+	restDefaultScript = "/export"
+)
+
+type REST struct {
+	Name     string
+	URL      string // Base URL i.e. https://host/rest
+	Username string
+	Password string
+	Script   string
+	Paths    []string
+	// Output format for menu paths: json or yaml
+	Format         string
+	Client         *http.Client
+	Logger         *logrus.Logger
+	ExportMetadata Metadata
+	DeviceMetadata Metadata
+}
+
+type restError struct {
+	Error   int    `json:"error"`
+	Message string `json:"message"`
+	Detail  string `json:"detail"`
+}
+
+func (r *REST) do(ctx context.Context, method, path string, body interface{}, v interface{}) error {
+	var rd io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(buf)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(r.URL, "/")+"/"+strings.TrimPrefix(path, "/"), rd)
+	if err != nil {
+		return err
+	}
+
+	req = req.WithContext(ctx)
+	req.SetBasicAuth(r.Username, r.Password)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := r.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		buf, _ := ioutil.ReadAll(io.LimitReader(res.Body, restMaxErrorBody))
+
+		var e restError
+		if json.Unmarshal(buf, &e) == nil && e.Message != "" {
+			if e.Detail != "" {
+				return fmt.Errorf("%s %s: %s: %s", method, path, e.Message, e.Detail)
+			}
+			return fmt.Errorf("%s %s: %s", method, path, e.Message)
+		}
+
+		return fmt.Errorf("%s %s: %s", method, path, res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func (r *REST) Export(ctx context.Context) (response io.ReadCloser, metadata Metadata, err error) {
+	l := r.Logger.WithFields(logrus.Fields{
+		"name": r.Name,
+		"url":  r.URL,
+	})
+
+	var buf bytes.Buffer
+
+	if len(r.Paths) == 0 {
+		script := r.Script
+		if script == "" {
+			script = restDefaultScript
+		}
+
+		l.Infof("executing `%s'...", script)
+
+		req := map[string]string{
+			"script":    script,
+			"as-string": "",
+		}
+
+		var res struct {
+			Ret string `json:"ret"`
+		}
+
+		if err := r.do(ctx, "POST", "/execute", req, &res); err != nil {
+			return nil, r.ExportMetadata, fmt.Errorf("rest: %v", err)
+		}
+
+		buf.WriteString(res.Ret)
+		if !strings.HasSuffix(res.Ret, "\n") {
+			buf.WriteByte('\n')
+		}
+
+		return ioutil.NopCloser(&buf), r.ExportMetadata, nil
+	}
+
+	// Menu paths. Both encoders sort map keys so the output is deterministic
+	doc := make(map[string]interface{}, len(r.Paths))
+
+	for _, p := range r.Paths {
+		p = "/" + strings.Trim(p, "/")
+		l.Infof("fetching `%s'...", p)
+
+		var v interface{}
+		if err := r.do(ctx, "GET", p, nil, &v); err != nil {
+			return nil, r.ExportMetadata, fmt.Errorf("rest: %v", err)
+		}
+
+		doc[p] = v
+	}
+
+	switch r.Format {
+	case "yaml":
+		out, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, r.ExportMetadata, fmt.Errorf("rest: %v", err)
+		}
+		buf.Write(out)
+
+	default:
+		out, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return nil, r.ExportMetadata, fmt.Errorf("rest: %v", err)
+		}
+		buf.Write(out)
+		buf.WriteByte('\n')
+	}
+
+	return ioutil.NopCloser(&buf), r.ExportMetadata, nil
+}
+
+func (r *REST) Metadata() Metadata {
+	return r.DeviceMetadata
+}
+
+func newREST(options config.Options, logger *logrus.Logger) (Exporter, error) {
+	r := REST{
+		Logger: logger,
+	}
+
+	r.Name, _ = options.GetString("name")
+	r.URL, _ = options.GetString("url")
+	r.Username, _ = options.GetString("username")
+	r.Password, _ = options.GetString("password")
+	r.Script, _ = options.GetString("script")
+	r.Format, _ = options.GetString("format")
+
+	host, _ := options.GetString("host")
+
+	if r.URL == "" {
+		if host == "" {
+			return nil, errors.New("rest: address missing")
+		}
+
+		u := url.URL{
+			Scheme: "https",
+			Host:   host,
+			Path:   "/rest",
+		}
+
+		if port, _ := options.GetString("port"); port != "" {
+			u.Host = net.JoinHostPort(host, port)
+		}
+
+		r.URL = u.String()
+	} else if host == "" {
+		if u, err := url.Parse(r.URL); err == nil {
+			host = u.Hostname()
+		}
+	}
+
+	if r.Username == "" {
+		return nil, errors.New("rest: user name missing")
+	}
+
+	switch r.Format {
+	case "", "json", "yaml":
+	default:
+		return nil, fmt.Errorf("rest: unknown format: `%s'", r.Format)
+	}
+
+	if val, ok := options["paths"]; ok {
+		switch v := val.(type) {
+		case string:
+			r.Paths = []string{v}
+		case []interface{}:
+			for _, vv := range v {
+				if s, ok := vv.(string); ok {
+					r.Paths = append(r.Paths, s)
+				}
+			}
+		}
+	}
+
+	// The export is either the script output or the menu paths document
+	if r.Script != "" && len(r.Paths) != 0 {
+		return nil, errors.New("rest: `script' and `paths' are mutually exclusive")
+	}
+
+	tlsConfig, err := newTLSConfig(options)
+	if err != nil {
+		return nil, fmt.Errorf("rest: %v", err)
+	}
+
+	r.Client = &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+
+	// Filter out password
+	metadata := make(Metadata, len(options))
+	for k, v := range options {
+		if k != "password" {
+			metadata[k] = v
+		}
+	}
+
+	r.ExportMetadata = metadata
+	r.DeviceMetadata = Metadata{
+		"name":   r.Name,
+		"host":   host,
+		"device": "rest",
+	}
+
+	return &r, nil
+}
+
+func init() {
+	registerExporter("rest", newREST)
+}
@@ -0,0 +1,211 @@
+package devices
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ecadlabs/rosdump/config"
+	"github.com/sirupsen/logrus"
+)
+
+type restTestReply struct {
+	status int
+	body   string
+}
+
+func newTestLogger() *logrus.Logger {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	return l
+}
+
+func TestREST(t *testing.T) {
+	tests := []struct {
+		name    string
+		options config.Options
+		replies map[string]restTestReply
+		output  string
+		err     string
+	}{
+		{
+			name: "script",
+			replies: map[string]restTestReply{
+				"POST /rest/execute {\"as-string\":\"\",\"script\":\"/export\"}": {body: `{"ret":"/ip address\nadd address=10.0.0.1/24"}`},
+			},
+			output: "/ip address\nadd address=10.0.0.1/24\n",
+		},
+		{
+			name:    "custom script",
+			options: config.Options{"script": "/export terse"},
+			replies: map[string]restTestReply{
+				"POST /rest/execute {\"as-string\":\"\",\"script\":\"/export terse\"}": {body: `{"ret":"/system identity set name=r1\n"}`},
+			},
+			output: "/system identity set name=r1\n",
+		},
+		{
+			name:    "wrong password",
+			options: config.Options{"password": "wrong"},
+			err:     "rest: POST /execute: Unauthorized",
+		},
+		{
+			name:    "error detail",
+			options: config.Options{"paths": []interface{}{"/ip/adress"}},
+			replies: map[string]restTestReply{
+				"GET /rest/ip/adress": {status: http.StatusBadRequest, body: `{"error":400,"message":"Bad Request","detail":"no such command or directory (adress)"}`},
+			},
+			err: "rest: GET /ip/adress: Bad Request: no such command or directory (adress)",
+		},
+		{
+			name:    "plain error",
+			options: config.Options{"paths": "/ip/address"},
+			replies: map[string]restTestReply{
+				"GET /rest/ip/address": {status: http.StatusInternalServerError, body: "oops"},
+			},
+			err: "rest: GET /ip/address: 500 Internal Server Error",
+		},
+		{
+			name:    "paths",
+			options: config.Options{"paths": []interface{}{"ip/address/", "/system/identity"}},
+			replies: map[string]restTestReply{
+				"GET /rest/ip/address":      {body: `[{".id":"*1","address":"10.0.0.1/24","interface":"ether1"}]`},
+				"GET /rest/system/identity": {body: `{"name":"r1"}`},
+			},
+			output: `{
+  "/ip/address": [
+    {
+      ".id": "*1",
+      "address": "10.0.0.1/24",
+      "interface": "ether1"
+    }
+  ],
+  "/system/identity": {
+    "name": "r1"
+  }
+}
+`,
+		},
+		{
+			name:    "paths yaml",
+			options: config.Options{"paths": "/system/identity", "format": "yaml"},
+			replies: map[string]restTestReply{
+				"GET /rest/system/identity": {body: `{"name":"r1"}`},
+			},
+			output: "/system/identity:\n  name: r1\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+
+				if user, pass, ok := req.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+					w.WriteHeader(http.StatusUnauthorized)
+					w.Write([]byte(`{"error":401,"message":"Unauthorized"}`))
+					return
+				}
+
+				key := req.Method + " " + req.URL.Path
+				if req.Method == "POST" {
+					var body map[string]string
+					if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+						t.Error(err)
+					}
+					buf, _ := json.Marshal(body)
+					key += " " + string(buf)
+				}
+
+				reply, ok := test.replies[key]
+				if !ok {
+					t.Errorf("unexpected request: %s", key)
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+
+				if reply.status != 0 {
+					w.WriteHeader(reply.status)
+				}
+				w.Write([]byte(reply.body))
+			}))
+			defer srv.Close()
+
+			options := config.Options{
+				"url":      srv.URL + "/rest",
+				"username": "admin",
+				"password": "secret",
+			}
+			for k, v := range test.options {
+				options[k] = v
+			}
+
+			e, err := newREST(options, newTestLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, _, err := e.Export(context.Background())
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("got error %v, expected %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Close()
+
+			out, err := ioutil.ReadAll(res)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(out) != test.output {
+				t.Errorf("got %q, expected %q", out, test.output)
+			}
+		})
+	}
+}
+
+func TestRESTOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options config.Options
+		url     string
+		err     string
+	}{
+		{name: "host", options: config.Options{"host": "r1", "username": "admin"}, url: "https://r1/rest"},
+		{name: "port", options: config.Options{"host": "r1", "port": "8443", "username": "admin"}, url: "https://r1:8443/rest"},
+		{name: "no address", options: config.Options{"username": "admin"}, err: "rest: address missing"},
+		{name: "no user", options: config.Options{"host": "r1"}, err: "rest: user name missing"},
+		{name: "format", options: config.Options{"host": "r1", "username": "admin", "format": "xml"}, err: "rest: unknown format: `xml'"},
+		{
+			name:    "script and paths",
+			options: config.Options{"host": "r1", "username": "admin", "script": "/export", "paths": "/ip/address"},
+			err:     "rest: `script' and `paths' are mutually exclusive",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, err := newREST(test.options, newTestLogger())
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("got error %v, expected %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if u := e.(*REST).URL; u != test.url {
+				t.Errorf("got %s, expected %s", u, test.url)
+			}
+		})
+	}
+}
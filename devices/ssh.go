@@ -0,0 +1,568 @@
+package devices
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ecadlabs/rosdump/config"
+	"github.com/ecadlabs/rosdump/sshutils"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHDevice holds connection options shared by SSH based drivers
+type SSHDevice struct {
+	Name string
+	Host string
+	// Actual host name to connect to if differs from Host
+	HostName string
+	Port     string
+	Config   sshutils.Config
+	// Collect device facts before export
+	Facts          bool
+	Logger         *logrus.Logger
+	ExportMetadata Metadata
+	DeviceMetadata Metadata
+}
+
+func (s *SSHDevice) address() string {
+	port := s.Port
+	if port == "" {
+		port = "22"
+	}
+
+	host := s.HostName
+	if host == "" {
+		host = s.Host
+	}
+
+	return net.JoinHostPort(host, port)
+}
+
+func (s *SSHDevice) logger() *logrus.Entry {
+	return s.Logger.WithFields(logrus.Fields{
+		"name":    s.Name,
+		"address": s.address(),
+	})
+}
+
+func (s *SSHDevice) dial(ctx context.Context) (*sshutils.Client, error) {
+	s.logger().Info("establishing SSH connection...")
+
+	return sshutils.Dial(ctx, s.address(), &s.Config)
+}
+
+// sshConn is a connection which deadline follows the context
+type sshConn struct {
+	*sshutils.Client
+	ctx  context.Context
+	done chan struct{}
+	once sync.Once
+}
+
+func (s *SSHDevice) connect(ctx context.Context) (*sshConn, error) {
+	client, err := s.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if d, ok := ctx.Deadline(); ok {
+		client.SetDeadline(d)
+	}
+
+	conn := sshConn{
+		Client: client,
+		ctx:    ctx,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			client.SetDeadline(time.Now())
+		case <-conn.done:
+		}
+	}()
+
+	return &conn, nil
+}
+
+func (c *sshConn) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return c.Client.Close()
+}
+
+// start runs the command and returns its output stream
+func (c *sshConn) start(command string) (*sshStream, error) {
+	session, err := sshutils.NewSession(c.ctx, c.Client.Client)
+	if err != nil {
+		return nil, fmt.Errorf("new session: %v", err)
+	}
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	if err = session.Start(command); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("session start: %v", err)
+	}
+
+	return &sshStream{
+		rd:      bufio.NewReader(stdout),
+		session: session,
+		conn:    c,
+	}, nil
+}
+
+type sshStream struct {
+	rd      io.Reader
+	session *ssh.Session
+	conn    *sshConn
+}
+
+func (s *sshStream) Read(p []byte) (int, error) {
+	n, err := s.rd.Read(p)
+	if err != nil {
+		// Interrupted connection may look like a regular EOF
+		if e := s.conn.ctx.Err(); e != nil {
+			err = e
+		}
+	}
+	return n, err
+}
+
+func (s *sshStream) Close() error {
+	if err := s.session.Wait(); err != nil {
+		return err
+	}
+
+	if err := s.session.Close(); err != nil && err != io.EOF {
+		return err
+	}
+
+	return nil
+}
+
+func (s *SSHDevice) Metadata() Metadata {
+	return s.DeviceMetadata
+}
+
+// Options inherited by jump hosts from the device
+var jumpHostInherited = []string{
+	"username",
+	"identity_file",
+	"ssh_agent",
+	"host_key_policy",
+	"known_hosts",
+	"host_key_store",
+	"proxy",
+	"bind_address",
+	"bind_interface",
+}
+
+// Options inherited by credential sets from the device
+var credentialsInherited = []string{
+	"username",
+	"identity_file",
+	"ssh_agent",
+}
+
+// Passphrase sources are inherited together
+var passphraseOptions = []string{
+	"identity_passphrase",
+	"identity_passphrase_env",
+	"identity_passphrase_file",
+}
+
+// inheritOptions copies keys missing in dst from src
+func inheritOptions(dst, src config.Options, keys []string) {
+	for _, k := range keys {
+		if _, ok := dst[k]; !ok {
+			if v, ok := src[k]; ok {
+				dst[k] = v
+			}
+		}
+	}
+
+	for _, k := range passphraseOptions {
+		if _, ok := dst[k]; ok {
+			return
+		}
+	}
+
+	for _, k := range passphraseOptions {
+		if v, ok := src[k]; ok {
+			dst[k] = v
+		}
+	}
+}
+
+func mapOptions(m map[interface{}]interface{}) config.Options {
+	opt := make(config.Options, len(m))
+	for k, v := range m {
+		opt[fmt.Sprintf("%v", k)] = v
+	}
+	return opt
+}
+
+// parseJumpHost parses `[user@]host[:port]'
+func parseJumpHost(s string) config.Options {
+	opt := make(config.Options)
+
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		opt["username"] = s[:i]
+		s = s[i+1:]
+	}
+
+	if host, port, err := net.SplitHostPort(s); err == nil {
+		opt["host"] = host
+		opt["port"] = port
+	} else {
+		opt["host"] = s
+	}
+
+	return opt
+}
+
+func newJumpHosts(options config.Options, logger *logrus.Logger) ([]*sshutils.JumpHost, error) {
+	val, ok := options["jump_hosts"]
+	if !ok {
+		return nil, nil
+	}
+
+	list, ok := val.([]interface{})
+	if !ok {
+		list = []interface{}{val}
+	}
+
+	res := make([]*sshutils.JumpHost, 0, len(list))
+
+	for _, v := range list {
+		var opt config.Options
+
+		switch vv := v.(type) {
+		case string:
+			opt = parseJumpHost(vv)
+
+		case map[interface{}]interface{}:
+			opt = mapOptions(vv)
+
+		default:
+			return nil, fmt.Errorf("invalid jump host: %v", v)
+		}
+
+		if v, ok := options["ssh_config"]; ok {
+			if _, ok := opt["ssh_config"]; !ok {
+				opt["ssh_config"] = v
+			}
+		}
+
+		opt, err := resolveSSHConfig(opt, logger)
+		if err != nil {
+			return nil, err
+		}
+		// Chain is flat
+		delete(opt, "jump_hosts")
+
+		inheritOptions(opt, options, jumpHostInherited)
+
+		host, _ := opt.GetString("host")
+		if host == "" {
+			return nil, errors.New("jump host address missing")
+		}
+
+		port, _ := opt.GetString("port")
+		if port == "" {
+			port = "22"
+		}
+
+		if h, _ := opt.GetString("hostname"); h != "" {
+			host = h
+		}
+
+		conf, err := newSSHConfig(opt)
+		if err != nil {
+			return nil, fmt.Errorf("jump host %s: %v", host, err)
+		}
+
+		res = append(res, &sshutils.JumpHost{
+			Address: net.JoinHostPort(host, port),
+			Config:  conf,
+		})
+	}
+
+	return res, nil
+}
+
+// newSSHCredentials builds a credential set from options
+func newSSHCredentials(options config.Options) (*sshutils.Credentials, error) {
+	var cred sshutils.Credentials
+
+	cred.Username, _ = options.GetString("username")
+	cred.Password, _ = options.GetString("password")
+
+	if cred.Username == "" {
+		return nil, errors.New("user name missing")
+	}
+
+	var keyFiles []string
+	switch v := options["identity_file"].(type) {
+	case string:
+		keyFiles = []string{v}
+	case []interface{}:
+		for _, vv := range v {
+			if s, ok := vv.(string); ok {
+				keyFiles = append(keyFiles, s)
+			}
+		}
+	}
+
+	passphrase, err := options.GetSecret("identity_passphrase")
+	if err != nil && err != config.ErrOptNotFound {
+		return nil, err
+	}
+
+	for _, name := range keyFiles {
+		if name == "" {
+			continue
+		}
+
+		signer, err := sshutils.LoadIdentity(name, []byte(passphrase))
+		if err != nil {
+			return nil, err
+		}
+
+		cred.Signers = append(cred.Signers, signer)
+	}
+
+	if cred.AgentSocket, err = sshutils.AgentSocket(options["ssh_agent"]); err != nil {
+		return nil, err
+	}
+
+	return &cred, nil
+}
+
+// newDialer returns a dialer honouring bind and proxy options. Nil is returned if none is set
+func newDialer(options config.Options) (sshutils.Dialer, error) {
+	bindAddress, _ := options.GetString("bind_address")
+	bindInterface, _ := options.GetString("bind_interface")
+	bind, err := sshutils.NewBindDialer(bindAddress, bindInterface)
+	if err != nil {
+		return nil, err
+	}
+
+	// The proxy itself is reached from the source address
+	var forward sshutils.Dialer
+	if bind != nil {
+		forward = bind
+	}
+
+	proxy, _ := options.GetString("proxy")
+	dialer, err := sshutils.NewProxyDialer(proxy, forward)
+	if err != nil {
+		return nil, err
+	}
+
+	if dialer != nil {
+		return dialer, nil
+	}
+
+	return forward, nil
+}
+
+// stripProxyCredentials removes user name and password from the proxy URL
+func stripProxyCredentials(metadata Metadata) {
+	proxy, ok := metadata["proxy"].(string)
+	if !ok {
+		return
+	}
+
+	if u, err := url.Parse(proxy); err == nil && u.User != nil {
+		u.User = nil
+		metadata["proxy"] = u.String()
+	}
+}
+
+// newSSHConfig builds connection configuration from options
+func newSSHConfig(options config.Options) (*sshutils.Config, error) {
+	var conf sshutils.Config
+
+	if val, ok := options["credentials"]; ok {
+		list, ok := val.([]interface{})
+		if !ok {
+			return nil, errors.New("credentials must be a list")
+		}
+
+		for i, v := range list {
+			m, ok := v.(map[interface{}]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid credentials: %v", v)
+			}
+
+			opt := mapOptions(m)
+			inheritOptions(opt, options, credentialsInherited)
+
+			cred, err := newSSHCredentials(opt)
+			if err != nil {
+				return nil, fmt.Errorf("credentials %d: %v", i, err)
+			}
+
+			if cred.Name, _ = opt.GetString("name"); cred.Name == "" {
+				cred.Name = strconv.Itoa(i)
+			}
+
+			conf.Credentials = append(conf.Credentials, cred)
+		}
+
+		if len(conf.Credentials) == 0 {
+			return nil, errors.New("credentials list is empty")
+		}
+	} else {
+		cred, err := newSSHCredentials(options)
+		if err != nil {
+			return nil, err
+		}
+
+		conf.Credentials = []*sshutils.Credentials{cred}
+	}
+
+	var err error
+
+	if t, _ := options.GetString("connect_timeout"); t != "" {
+		if conf.ConnectTimeout, err = time.ParseDuration(t); err != nil {
+			return nil, fmt.Errorf("connect_timeout: %v", err)
+		}
+	}
+
+	if conf.Dialer, err = newDialer(options); err != nil {
+		return nil, err
+	}
+
+	// Individual lists modify the preset
+	base := sshutils.AlgorithmPresets["default"]
+	if name, _ := options.GetString("algorithms"); name != "" {
+		p, ok := sshutils.AlgorithmPresets[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown algorithms preset: `%s'", name)
+		}
+		base = p
+		conf.Algorithms = *p
+	}
+
+	algorithms := []struct {
+		option   string
+		dst      *[]string
+		defaults []string
+	}{
+		{"ciphers", &conf.Ciphers, base.Ciphers},
+		{"kex_algorithms", &conf.KeyExchanges, base.KeyExchanges},
+		{"macs", &conf.MACs, base.MACs},
+		{"host_key_algorithms", &conf.HostKeyAlgorithms, base.HostKeyAlgorithms},
+	}
+
+	for _, a := range algorithms {
+		var spec string
+		switch v := options[a.option].(type) {
+		case string:
+			spec = v
+		case []interface{}:
+			list := make([]string, 0, len(v))
+			for _, vv := range v {
+				if s, ok := vv.(string); ok {
+					list = append(list, s)
+				}
+			}
+			spec = strings.Join(list, ",")
+		}
+
+		if spec != "" {
+			*a.dst = sshutils.ParseAlgorithms(spec, a.defaults)
+		}
+	}
+
+	policy, _ := options.GetString("host_key_policy")
+	knownHosts, _ := options.GetString("known_hosts")
+	if policy == sshutils.HostKeyTOFU {
+		knownHosts, _ = options.GetString("host_key_store")
+	}
+
+	if conf.HostKeyCallback, err = sshutils.NewHostKeyCallback(policy, knownHosts); err != nil {
+		return nil, err
+	}
+
+	if policy == sshutils.HostKeyStrict {
+		conf.KnownHosts = knownHosts
+		if conf.KnownHosts == "" {
+			conf.KnownHosts = sshutils.DefaultKnownHosts
+		}
+	}
+
+	return &conf, nil
+}
+
+func newSSHDevice(driver string, options config.Options, logger *logrus.Logger) (*SSHDevice, error) {
+	dev := SSHDevice{
+		Logger: logger,
+	}
+
+	// Filter out passwords
+	metadata := make(Metadata, len(options))
+	for k, v := range options {
+		if k != "password" && k != "identity_passphrase" && k != "jump_hosts" && k != "credentials" {
+			metadata[k] = v
+		}
+	}
+	stripProxyCredentials(metadata)
+
+	dev.Name, _ = options.GetString("name")
+	dev.Host, _ = options.GetString("host")
+	dev.Facts, _ = options.GetBool("facts")
+
+	if dev.Host == "" {
+		return nil, errors.New(driver + ": address missing")
+	}
+
+	options, err := resolveSSHConfig(options, logger)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", driver, err)
+	}
+
+	dev.HostName, _ = options.GetString("hostname")
+	dev.Port, _ = options.GetString("port")
+
+	conf, err := newSSHConfig(options)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", driver, err)
+	}
+
+	if policy, _ := options.GetString("host_key_policy"); policy == "" {
+		dev.logger().Warnln("host_key_policy is not set, host keys are not verified")
+	}
+
+	if conf.JumpHosts, err = newJumpHosts(options, logger); err != nil {
+		return nil, fmt.Errorf("%s: %v", driver, err)
+	}
+
+	dev.Config = *conf
+
+	dev.ExportMetadata = metadata
+	dev.DeviceMetadata = Metadata{
+		"name":   dev.Name,
+		"host":   dev.Host,
+		"device": driver,
+	}
+
+	return &dev, nil
+}
@@ -1,246 +1,220 @@
 package devices
 
 import (
-	"bufio"
 	"context"
 	"errors"
 	"fmt"
 	"io"
-	"net"
-	"sync"
-	"time"
+	"strings"
 
 	"github.com/ecadlabs/rosdump/config"
-	"github.com/ecadlabs/rosdump/sshutils"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/crypto/ssh"
 )
 
 type SSHCommand struct {
-	KeyFunc        sshutils.KeyFunc
-	Name           string
-	Host           string
-	Port           string
-	Username       string
-	Password       string
-	Command        string
-	Logger         *logrus.Logger
-	ExportMetadata Metadata
-	DeviceMetadata Metadata
+	*SSHDevice
+	Command string
+	// Optional platform profile
+	Profile *Profile
 }
 
 type sshCommandResponse struct {
-	io.Reader
-	session *ssh.Session
-	client  *sshutils.Client
+	*sshStream
 }
 
-type readNotifier struct {
-	rd         io.Reader
-	done       chan<- struct{}
-	pendingErr <-chan error
-	closed     bool
-	err        error
-	m          sync.Mutex
-}
-
-func (r *readNotifier) close(err error) {
-	r.m.Lock()
-	defer r.m.Unlock()
+func (s *sshCommandResponse) Close() (err error) {
+	defer func() {
+		if e := s.conn.Close(); err == nil {
+			err = e
+		}
+	}()
 
-	if !r.closed {
-		r.err = err
-		r.closed = true
-		close(r.done)
-	}
+	return s.sshStream.Close()
 }
 
-func (r *readNotifier) Read(p []byte) (int, error) {
-	r.m.Lock()
-	if r.closed {
-		defer r.m.Unlock()
-		return 0, r.err
+func (s *SSHCommand) Export(ctx context.Context) (response io.ReadCloser, metadata Metadata, err error) {
+	command := s.Command
+	if command == "" {
+		command = "export"
 	}
-	r.m.Unlock()
 
-	n, err := r.rd.Read(p)
+	conn, err := s.connect(ctx)
 	if err != nil {
-		select {
-		case err = <-r.pendingErr:
-		default:
-		}
+		return nil, s.ExportMetadata, fmt.Errorf("ssh-command: %v", err)
+	}
 
-		r.close(err)
+	metadata, err = s.exportMetadata(conn)
+	if err != nil {
+		conn.Close()
+		return nil, metadata, fmt.Errorf("ssh-command: %v", err)
 	}
-	return n, err
-}
 
-func (s *sshCommandResponse) Close() (err error) {
-	defer func() {
-		e := s.client.Close()
-		if err == nil {
-			err = e
-		}
-		s.Reader.(*readNotifier).close(io.EOF)
-	}()
+	s.logger().Infof("issuing `%s' command...", command)
 
-	if err := s.session.Wait(); err != nil {
-		return err
+	stream, err := conn.start(command)
+	if err != nil {
+		conn.Close()
+		return nil, metadata, fmt.Errorf("ssh-command: %v", err)
 	}
 
-	if err := s.session.Close(); err != nil && err != io.EOF {
-		return err
-	}
+	return newStripReader(&sshCommandResponse{stream}, s.Profile), metadata, nil
+}
 
-	return nil
+// SSHCommandArtifact is a command which output is stored as a separate artifact
+type SSHCommandArtifact struct {
+	Name    string
+	Command string
 }
 
-func (s *SSHCommand) Export(ctx context.Context) (response io.ReadCloser, metadata Metadata, err error) {
-	sshConfig := sshutils.Config{
-		KeyFunc:  s.KeyFunc,
-		Username: s.Username,
-		Password: s.Password,
-	}
+// SSHMultiCommand runs several commands over the same connection
+type SSHMultiCommand struct {
+	*SSHDevice
+	Commands []*SSHCommandArtifact
+	// Optional platform profile
+	Profile *Profile
+}
 
-	port := s.Port
-	if port == "" {
-		port = "22"
-	}
+type sshArtifactReader struct {
+	s    *SSHMultiCommand
+	conn *sshConn
+	i    int
+}
 
-	command := s.Command
-	if command == "" {
-		command = "export"
+func (r *sshArtifactReader) Next() (string, io.ReadCloser, error) {
+	if r.i == len(r.s.Commands) {
+		return "", nil, io.EOF
 	}
 
-	address := net.JoinHostPort(s.Host, port)
+	cmd := r.s.Commands[r.i]
+	r.i++
 
-	l := s.Logger.WithFields(logrus.Fields{
-		"name":    s.Name,
-		"address": address,
-	})
+	r.s.logger().WithField("artifact", cmd.Name).Infof("issuing `%s' command...", cmd.Command)
 
-	l.Info("establishing SSH connection...")
+	stream, err := r.conn.start(cmd.Command)
+	if err != nil {
+		return cmd.Name, nil, fmt.Errorf("ssh-command: %v", err)
+	}
+
+	return cmd.Name, newStripReader(stream, r.s.Profile), nil
+}
 
-	client, err := sshutils.Dial(ctx, address, &sshConfig)
+func (r *sshArtifactReader) Close() error {
+	return r.conn.Close()
+}
+
+func (s *SSHMultiCommand) ExportArtifacts(ctx context.Context) (ArtifactReader, Metadata, error) {
+	conn, err := s.connect(ctx)
 	if err != nil {
 		return nil, s.ExportMetadata, fmt.Errorf("ssh-command: %v", err)
 	}
 
-	defer func() {
-		if err != nil {
-			client.Close()
-		}
-	}()
-
-	if d, ok := ctx.Deadline(); ok {
-		client.SetDeadline(d)
+	metadata, err := s.exportMetadata(conn)
+	if err != nil {
+		conn.Close()
+		return nil, metadata, fmt.Errorf("ssh-command: %v", err)
 	}
 
-	now := time.Now()
-	readDone := make(chan struct{})
+	return &sshArtifactReader{
+		s:    s,
+		conn: conn,
+	}, metadata, nil
+}
 
-	defer func() {
-		if err != nil {
-			close(readDone)
-		}
-	}()
+// Export returns concatenated output of all commands
+func (s *SSHMultiCommand) Export(ctx context.Context) (io.ReadCloser, Metadata, error) {
+	ar, metadata, err := s.ExportArtifacts(ctx)
+	if err != nil {
+		return nil, metadata, err
+	}
 
-	pendingErr := make(chan error, 1)
+	return concatArtifacts(ar), metadata, nil
+}
 
-	go func() {
-		select {
-		case <-ctx.Done():
-			pendingErr <- ctx.Err()
-			client.SetDeadline(now)
-		case <-readDone:
+// artifactName derives artifact name from the command i.e. `/system resource print' -> `system-resource-print'
+func artifactName(command string) string {
+	var words []string
+	for _, w := range strings.Fields(command) {
+		if w = strings.Trim(w, "/"); w != "" {
+			words = append(words, strings.Replace(w, "/", "-", -1))
 		}
-	}()
+	}
+
+	return strings.Join(words, "-")
+}
 
-	session, err := client.NewSession()
+func newSSHCommand(options config.Options, logger *logrus.Logger) (Exporter, error) {
+	dev, err := newSSHDevice("ssh-command", options, logger)
 	if err != nil {
-		return nil, s.ExportMetadata, fmt.Errorf("ssh-command: new session: %v", err)
+		return nil, err
 	}
 
-	stdout, err := session.StdoutPipe()
+	profile, err := getProfile(options)
 	if err != nil {
-		return nil, s.ExportMetadata, err
+		return nil, fmt.Errorf("ssh-command: %v", err)
 	}
 
-	l.Infof("issuing `%s' command...", command)
+	if val, ok := options["commands"]; ok {
+		list, ok := val.([]interface{})
+		if !ok {
+			return nil, errors.New("ssh-command: commands must be a list")
+		}
 
-	if err = session.Start(command); err != nil {
-		return nil, s.ExportMetadata, fmt.Errorf("ssh-command: session start: %v", err)
-	}
+		cmd := SSHMultiCommand{
+			SSHDevice: dev,
+			Commands:  make([]*SSHCommandArtifact, 0, len(list)),
+			Profile:   profile,
+		}
 
-	rn := readNotifier{
-		rd:         bufio.NewReader(stdout),
-		done:       readDone,
-		pendingErr: pendingErr,
-	}
+		names := make(map[string]struct{}, len(list))
 
-	res := sshCommandResponse{
-		Reader:  &rn,
-		client:  client,
-		session: session,
-	}
+		for _, v := range list {
+			var a SSHCommandArtifact
 
-	return &res, s.ExportMetadata, nil
-}
+			switch vv := v.(type) {
+			case string:
+				a.Command = vv
 
-func (s *SSHCommand) Metadata() Metadata {
-	return s.DeviceMetadata
-}
+			case map[interface{}]interface{}:
+				opt := make(config.Options, len(vv))
+				for k, v := range vv {
+					opt[fmt.Sprintf("%v", k)] = v
+				}
 
-func newSSHCommand(options config.Options, logger *logrus.Logger) (Exporter, error) {
-	cmd := SSHCommand{
-		Logger: logger,
-	}
+				a.Name, _ = opt.GetString("name")
+				a.Command, _ = opt.GetString("command")
+			}
 
-	cmd.Name, _ = options.GetString("name")
-	cmd.Host, _ = options.GetString("host")
-	cmd.Port, _ = options.GetString("port")
-	cmd.Username, _ = options.GetString("username")
-	cmd.Password, _ = options.GetString("password")
-	cmd.Command, _ = options.GetString("command")
+			if a.Command == "" {
+				return nil, errors.New("ssh-command: command missing")
+			}
 
-	if cmd.Host == "" {
-		return nil, errors.New("ssh-command: address missing")
-	}
+			if a.Name == "" {
+				a.Name = artifactName(a.Command)
+			}
 
-	if cmd.Username == "" {
-		return nil, errors.New("ssh-command: user name missing")
-	}
+			if _, ok := names[a.Name]; ok {
+				return nil, fmt.Errorf("ssh-command: duplicate artifact name: `%s'", a.Name)
+			}
+			names[a.Name] = struct{}{}
 
-	/*
-		if cmd.Command == "" {
-			return nil, errors.New("ssh-command: command missing")
+			cmd.Commands = append(cmd.Commands, &a)
 		}
-	*/
 
-	if keyFile, err := options.GetString("identity_file"); err == nil && keyFile != "" {
-		keyData, err := sshutils.ReadIdentityFile(keyFile)
-		if err != nil {
-			return nil, fmt.Errorf("ssh-command: %v", err)
+		if len(cmd.Commands) == 0 {
+			return nil, errors.New("ssh-command: commands list is empty")
 		}
 
-		cmd.KeyFunc = func() ([]byte, error) {
-			return keyData, nil
-		}
+		return &cmd, nil
 	}
 
-	// Filter out password
-	metadata := make(Metadata, len(options))
-	for k, v := range options {
-		if k != "password" {
-			metadata[k] = v
-		}
+	cmd := SSHCommand{
+		SSHDevice: dev,
+		Profile:   profile,
 	}
 
-	cmd.ExportMetadata = metadata
-	cmd.DeviceMetadata = Metadata{
-		"name":   cmd.Name,
-		"host":   cmd.Host,
-		"device": "ssh-command",
+	cmd.Command, _ = options.GetString("command")
+	if cmd.Command == "" && profile != nil {
+		cmd.Command = profile.Command
 	}
 
 	return &cmd, nil
@@ -0,0 +1,199 @@
+package devices
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/ecadlabs/rosdump/config"
+	"github.com/ecadlabs/rosdump/sshutils"
+	"github.com/mitchellh/go-homedir"
+	"github.com/sirupsen/logrus"
+)
+
+// sshConfigKeywords maps OpenSSH client configuration keywords to options
+var sshConfigKeywords = []struct {
+	keyword string
+	option  string
+}{
+	{"HostName", "hostname"},
+	{"Port", "port"},
+	{"User", "username"},
+	{"ProxyJump", "jump_hosts"},
+	{"ConnectTimeout", "connect_timeout"},
+	{"Ciphers", "ciphers"},
+	{"KexAlgorithms", "kex_algorithms"},
+	{"MACs", "macs"},
+	{"HostKeyAlgorithms", "host_key_algorithms"},
+}
+
+// loadSSHConfig interprets ssh_config option value: true means default OpenSSH files, non boolean string is a file path
+func loadSSHConfig(v interface{}, logger *logrus.Logger) (*sshutils.SSHConfig, error) {
+	var path string
+
+	switch vv := v.(type) {
+	case nil:
+		return nil, nil
+
+	case bool:
+		if !vv {
+			return nil, nil
+		}
+
+	case string:
+		b, err := strconv.ParseBool(vv)
+		if err != nil {
+			path = vv
+		} else if !b {
+			return nil, nil
+		}
+
+	default:
+		return nil, fmt.Errorf("invalid ssh_config value: %v", v)
+	}
+
+	return sshutils.LoadSSHConfig(path, logger)
+}
+
+// expandSSHConfigTokens expands a subset of OpenSSH percent tokens and leading tilde
+func expandSSHConfigTokens(s string, options config.Options) (string, error) {
+	var buf strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i == len(s)-1 {
+			buf.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case '%':
+			buf.WriteByte('%')
+
+		case 'h':
+			host, _ := options.GetString("host")
+			buf.WriteString(host)
+
+		case 'p':
+			port, _ := options.GetString("port")
+			if port == "" {
+				port = "22"
+			}
+			buf.WriteString(port)
+
+		case 'r':
+			username, _ := options.GetString("username")
+			buf.WriteString(username)
+
+		case 'd':
+			home, err := homedir.Dir()
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(home)
+
+		case 'u':
+			u, err := user.Current()
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(u.Username)
+
+		default:
+			return "", fmt.Errorf("unsupported token %%%c in `%s'", s[i], s)
+		}
+	}
+
+	return homedir.Expand(buf.String())
+}
+
+// resolveSSHConfig fills options missing from the device entry using OpenSSH client configuration
+// if ssh_config option is set. `host' is used as a Host alias
+func resolveSSHConfig(options config.Options, logger *logrus.Logger) (config.Options, error) {
+	c, err := loadSSHConfig(options["ssh_config"], logger)
+	if err != nil || c == nil {
+		return options, err
+	}
+
+	alias, _ := options.GetString("host")
+
+	res := make(config.Options, len(options))
+	for k, v := range options {
+		res[k] = v
+	}
+
+	for _, kw := range sshConfigKeywords {
+		if _, ok := options[kw.option]; ok {
+			// Explicit value wins
+			continue
+		}
+
+		val, err := c.Get(alias, kw.keyword)
+		if err != nil {
+			return nil, err
+		}
+
+		if val == "" {
+			continue
+		}
+
+		switch kw.option {
+		case "jump_hosts":
+			if val == "none" {
+				continue
+			}
+
+			var hops []interface{}
+			for _, h := range strings.Split(val, ",") {
+				if h = strings.TrimSpace(h); h != "" {
+					hops = append(hops, h)
+				}
+			}
+			res[kw.option] = hops
+
+		case "connect_timeout":
+			res[kw.option] = val + "s"
+
+		default:
+			res[kw.option] = val
+		}
+	}
+
+	// Tokens may refer to other resolved values
+	if _, ok := options["hostname"]; !ok {
+		if v, ok := res["hostname"].(string); ok {
+			if res["hostname"], err = expandSSHConfigTokens(v, res); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// IdentityFile may be given multiple times, all of them are tried in order
+	if _, ok := options["identity_file"]; !ok {
+		files, err := c.GetAll(alias, "IdentityFile")
+		if err != nil {
+			return nil, err
+		}
+
+		var list []interface{}
+		for _, f := range files {
+			if f, err = expandSSHConfigTokens(f, res); err != nil {
+				return nil, err
+			}
+
+			// Like OpenSSH skip missing identity files coming from configuration
+			if _, err := os.Stat(f); os.IsNotExist(err) {
+				continue
+			}
+			list = append(list, f)
+		}
+
+		if len(list) != 0 {
+			res["identity_file"] = list
+		}
+	}
+
+	return res, nil
+}
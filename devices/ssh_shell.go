@@ -0,0 +1,639 @@
+package devices
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ecadlabs/rosdump/config"
+	"github.com/ecadlabs/rosdump/sshutils"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultShellTerm        = "vt100"
+	defaultShellWidth       = 200
+	defaultShellStepTimeout = 30 * time.Second
+	defaultShellPager       = `--\s?[Mm]ore\s?--`
+	defaultShellPagerSend   = " "
+)
+
+// SSHShellStep sends a line and/or waits for the output matching the pattern
+type SSHShellStep struct {
+	// Line to send, nil if the step only waits for output
+	Send *string
+	// Nil if the step doesn't wait
+	Expect  *regexp.Regexp
+	Timeout time.Duration
+}
+
+// shellOptions are shared by interactive drivers
+type shellOptions struct {
+	// Line terminator appended to sent lines
+	Newline string
+	// Lines matching the prompt are removed from the output
+	Prompt *regexp.Regexp
+	// Pager prompt is answered with PagerSend and removed from the output. Paging is not handled if nil
+	Pager     *regexp.Regexp
+	PagerSend string
+	// Output is captured between lines matching the markers (exclusive). Nil means the beginning or the end of the session
+	CaptureStart *regexp.Regexp
+	CaptureEnd   *regexp.Regexp
+	// Optional platform profile
+	Profile     *Profile
+	StepTimeout time.Duration
+}
+
+// SSHShell runs a script over an interactive PTY shell for devices not supporting exec requests
+type SSHShell struct {
+	*SSHDevice
+	shellOptions
+	Script []*SSHShellStep
+	Term   string
+	Width  int
+	Height int
+}
+
+// termFilter removes escape sequences and control characters applying backspaces and carriage returns to the current line
+type termFilter struct {
+	state int
+}
+
+const (
+	termNormal = iota
+	termEsc
+	termEscArg
+	termCSI
+	termOSC
+	termCR
+)
+
+func clearLine(buf *bytes.Buffer) {
+	buf.Truncate(bytes.LastIndexByte(buf.Bytes(), '\n') + 1)
+}
+
+func (t *termFilter) write(buf *bytes.Buffer, p []byte) {
+	for _, c := range p {
+		switch t.state {
+		case termCR:
+			t.state = termNormal
+			if c != '\n' {
+				// Lone carriage return means the line is going to be overwritten
+				clearLine(buf)
+			}
+			fallthrough
+
+		case termNormal:
+			switch {
+			case c == 0x1b:
+				t.state = termEsc
+
+			case c == '\r':
+				t.state = termCR
+
+			case c == '\b':
+				if data := buf.Bytes(); len(data) != 0 && data[len(data)-1] != '\n' {
+					_, n := utf8.DecodeLastRune(data)
+					buf.Truncate(len(data) - n)
+				}
+
+			case c == '\n' || c == '\t' || c >= 0x20 && c != 0x7f:
+				buf.WriteByte(c)
+			}
+
+		case termEsc:
+			switch c {
+			case '[':
+				t.state = termCSI
+			case ']':
+				t.state = termOSC
+			case '(', ')', '#', '%':
+				t.state = termEscArg
+			default:
+				t.state = termNormal
+			}
+
+		case termEscArg:
+			t.state = termNormal
+
+		case termCSI:
+			if c >= 0x40 && c <= 0x7e {
+				t.state = termNormal
+			}
+
+		case termOSC:
+			if c == 0x07 {
+				t.state = termNormal
+			} else if c == 0x1b {
+				t.state = termEsc
+			}
+		}
+	}
+}
+
+// shellSession feeds the shell output to expect calls
+type shellSession struct {
+	opt   *shellOptions
+	ctx   context.Context
+	stdin io.Writer
+	data  chan []byte
+	done  chan struct{}
+	err   error
+	term  termFilter
+	// Unconsumed output
+	buf bytes.Buffer
+	// Consumed output
+	transcript bytes.Buffer
+	// Sent lines used to detect echoes
+	sent []string
+}
+
+func newShellSession(ctx context.Context, opt *shellOptions, rd io.Reader, wr io.Writer) *shellSession {
+	s := shellSession{
+		opt:   opt,
+		ctx:   ctx,
+		stdin: wr,
+		data:  make(chan []byte),
+		done:  make(chan struct{}),
+	}
+
+	go s.read(rd)
+
+	return &s
+}
+
+// Close stops the reader
+func (s *shellSession) Close() error {
+	close(s.done)
+	return nil
+}
+
+func (s *shellSession) read(rd io.Reader) {
+	defer close(s.data)
+
+	for {
+		p := make([]byte, 4096)
+		n, err := rd.Read(p)
+		if n != 0 {
+			select {
+			case s.data <- p[:n]:
+			case <-s.done:
+				return
+			}
+		}
+
+		if err != nil {
+			s.err = err
+			return
+		}
+	}
+}
+
+// write sends the line without tracking its echo
+func (s *shellSession) write(line string) error {
+	_, err := io.WriteString(s.stdin, line+s.opt.Newline)
+	return err
+}
+
+func (s *shellSession) send(line string) error {
+	if line != "" {
+		s.sent = append(s.sent, line)
+	}
+
+	return s.write(line)
+}
+
+// page answers the pager prompt if any
+func (s *shellSession) page() error {
+	if s.opt.Pager == nil {
+		return nil
+	}
+
+	data := s.buf.Bytes()
+	loc := s.opt.Pager.FindIndex(data)
+	if loc == nil {
+		return nil
+	}
+
+	rest := append([]byte(nil), data[loc[1]:]...)
+	s.buf.Truncate(loc[0])
+	s.buf.Write(rest)
+
+	_, err := io.WriteString(s.stdin, s.opt.PagerSend)
+	return err
+}
+
+func (s *shellSession) expect(re *regexp.Regexp, timeout time.Duration) error {
+	_, err := s.expectAny([]*regexp.Regexp{re}, timeout)
+	return err
+}
+
+// expectAny waits for any of the patterns and returns the index of the one matched first
+func (s *shellSession) expectAny(list []*regexp.Regexp, timeout time.Duration) (int, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		if err := s.page(); err != nil {
+			return -1, err
+		}
+
+		var (
+			idx = -1
+			loc []int
+		)
+
+		for i, re := range list {
+			if l := re.FindIndex(s.buf.Bytes()); l != nil && (loc == nil || l[0] < loc[0]) {
+				idx, loc = i, l
+			}
+		}
+
+		if loc != nil {
+			s.transcript.Write(s.buf.Next(loc[1]))
+			return idx, nil
+		}
+
+		select {
+		case p, ok := <-s.data:
+			if !ok {
+				err := s.err
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return -1, fmt.Errorf("expecting `%s': %v", list[0], err)
+			}
+			s.term.write(&s.buf, p)
+
+		case <-timer.C:
+			return -1, fmt.Errorf("timeout expecting `%s'", list[0])
+
+		case <-s.ctx.Done():
+			return -1, s.ctx.Err()
+		}
+	}
+}
+
+// run executes the script
+func (s *shellSession) run(script []*SSHShellStep, l *logrus.Entry) error {
+	for i, step := range script {
+		if step.Send != nil {
+			l.Debugf("sending `%s'...", *step.Send)
+
+			if err := s.send(*step.Send); err != nil {
+				return fmt.Errorf("step %d: %v", i, err)
+			}
+		}
+
+		if step.Expect != nil {
+			if err := s.expect(step.Expect, step.Timeout); err != nil {
+				return fmt.Errorf("step %d: %v", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// isEcho reports whether the line is a sent line echoed after an optional prompt
+func (s *shellOptions) isEcho(line, sent string) bool {
+	line = strings.TrimRight(line, " \t")
+	if !strings.HasSuffix(line, sent) {
+		return false
+	}
+
+	prefix := line[:len(line)-len(sent)]
+	return prefix == "" || s.Prompt == nil || s.Prompt.MatchString(prefix)
+}
+
+// capture extracts the output between markers removing echoes and prompts
+func (s *shellOptions) capture(transcript []byte, sent []string) ([]byte, error) {
+	lines := strings.Split(string(transcript), "\n")
+
+	// Echoes appear in the order lines were sent
+	drop := make([]bool, len(lines))
+	for i, line := range lines {
+		if len(sent) != 0 && s.isEcho(line, sent[0]) {
+			drop[i] = true
+			sent = sent[1:]
+		} else if s.Prompt != nil && s.Prompt.MatchString(line) {
+			drop[i] = true
+		} else if s.Profile != nil && s.Profile.stripLine(line) {
+			drop[i] = true
+		}
+	}
+
+	start := 0
+	if s.CaptureStart != nil {
+		for start < len(lines) && !s.CaptureStart.MatchString(lines[start]) {
+			start++
+		}
+		if start == len(lines) {
+			return nil, fmt.Errorf("capture start marker `%s' not found", s.CaptureStart)
+		}
+		start++
+	}
+
+	end := len(lines)
+	if s.CaptureEnd != nil {
+		end = start
+		for end < len(lines) && !s.CaptureEnd.MatchString(lines[end]) {
+			end++
+		}
+		if end == len(lines) {
+			return nil, fmt.Errorf("capture end marker `%s' not found", s.CaptureEnd)
+		}
+	}
+
+	var out bytes.Buffer
+	for i := start; i < end; i++ {
+		if !drop[i] {
+			out.WriteString(lines[i])
+			out.WriteByte('\n')
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+func (s *SSHShell) run(ctx context.Context, conn *sshConn) ([]byte, error) {
+	session, err := sshutils.NewSession(ctx, conn.Client.Client)
+	if err != nil {
+		return nil, fmt.Errorf("new session: %v", err)
+	}
+	defer session.Close()
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 38400,
+		ssh.TTY_OP_OSPEED: 38400,
+	}
+
+	if err := session.RequestPty(s.Term, s.Height, s.Width, modes); err != nil {
+		return nil, fmt.Errorf("request PTY: %v", err)
+	}
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := session.Shell(); err != nil {
+		return nil, fmt.Errorf("shell: %v", err)
+	}
+
+	sh := newShellSession(ctx, &s.shellOptions, stdout, stdin)
+	defer sh.Close()
+
+	if err := sh.run(s.Script, s.logger()); err != nil {
+		return nil, err
+	}
+
+	return s.capture(sh.transcript.Bytes(), sh.sent)
+}
+
+func (s *SSHShell) Export(ctx context.Context) (response io.ReadCloser, metadata Metadata, err error) {
+	conn, err := s.connect(ctx)
+	if err != nil {
+		return nil, s.ExportMetadata, fmt.Errorf("ssh-shell: %v", err)
+	}
+	defer conn.Close()
+
+	metadata, err = s.exportMetadata(conn)
+	if err != nil {
+		return nil, metadata, fmt.Errorf("ssh-shell: %v", err)
+	}
+
+	s.logger().Infof("running %d step script...", len(s.Script))
+
+	out, err := s.run(ctx, conn)
+	if err != nil {
+		return nil, metadata, fmt.Errorf("ssh-shell: %v", err)
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(out)), metadata, nil
+}
+
+// getRegexp compiles an optional pattern
+func getRegexp(options config.Options, name string) (*regexp.Regexp, error) {
+	s, _ := options.GetString(name)
+	if s == "" {
+		return nil, nil
+	}
+
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	return re, nil
+}
+
+func newSSHShellStep(v interface{}, timeout time.Duration) (*SSHShellStep, error) {
+	step := SSHShellStep{
+		Timeout: timeout,
+	}
+
+	switch vv := v.(type) {
+	case string:
+		step.Send = &vv
+		return &step, nil
+
+	case map[interface{}]interface{}:
+		opt := mapOptions(vv)
+
+		if _, ok := opt["send"]; ok {
+			s, _ := opt.GetString("send")
+			step.Send = &s
+		}
+
+		var err error
+		if step.Expect, err = getRegexp(opt, "expect"); err != nil {
+			return nil, err
+		}
+
+		if t, _ := opt.GetString("timeout"); t != "" {
+			if step.Timeout, err = time.ParseDuration(t); err != nil {
+				return nil, fmt.Errorf("timeout: %v", err)
+			}
+		}
+
+		if step.Send == nil && step.Expect == nil {
+			return nil, errors.New("either send or expect must be specified")
+		}
+
+		return &step, nil
+	}
+
+	return nil, errors.New("step must be a string or a map")
+}
+
+// commandScript disables paging, runs the command and exits. The prompt must be already received
+func commandScript(disablePaging, command string, prompt *regexp.Regexp, timeout time.Duration) []*SSHShellStep {
+	var script []*SSHShellStep
+
+	step := func(send string) {
+		script = append(script, &SSHShellStep{
+			Send:    &send,
+			Expect:  prompt,
+			Timeout: timeout,
+		})
+	}
+
+	if disablePaging != "" {
+		step(disablePaging)
+	}
+	step(command)
+
+	exit := "exit"
+	return append(script, &SSHShellStep{Send: &exit})
+}
+
+// captureAfter returns a marker matching the command echo
+func captureAfter(command string) *regexp.Regexp {
+	return regexp.MustCompile(regexp.QuoteMeta(command) + `\s*$`)
+}
+
+// newShellOptions parses options common for interactive drivers
+func newShellOptions(options config.Options, newline string) (*shellOptions, error) {
+	opt := shellOptions{
+		Newline:     newline,
+		PagerSend:   defaultShellPagerSend,
+		StepTimeout: defaultShellStepTimeout,
+	}
+
+	var err error
+
+	if nl, err := options.GetString("newline"); err == nil {
+		opt.Newline = nl
+	}
+
+	if opt.Profile, err = getProfile(options); err != nil {
+		return nil, err
+	}
+
+	if opt.Prompt, err = getRegexp(options, "prompt"); err != nil {
+		return nil, err
+	}
+
+	if opt.Prompt == nil && opt.Profile != nil {
+		opt.Prompt = opt.Profile.Prompt
+	}
+
+	// Empty value disables paging
+	pager := defaultShellPager
+	if p, err := options.GetString("pager"); err == nil {
+		pager = p
+	}
+
+	if pager != "" {
+		if opt.Pager, err = regexp.Compile(pager); err != nil {
+			return nil, fmt.Errorf("pager: %v", err)
+		}
+	}
+
+	if s, err := options.GetString("pager_send"); err == nil {
+		opt.PagerSend = s
+	}
+
+	if opt.CaptureStart, err = getRegexp(options, "capture_start"); err != nil {
+		return nil, err
+	}
+
+	if opt.CaptureEnd, err = getRegexp(options, "capture_end"); err != nil {
+		return nil, err
+	}
+
+	if t, _ := options.GetString("step_timeout"); t != "" {
+		if opt.StepTimeout, err = time.ParseDuration(t); err != nil {
+			return nil, fmt.Errorf("step_timeout: %v", err)
+		}
+	}
+
+	return &opt, nil
+}
+
+func newSSHShell(options config.Options, logger *logrus.Logger) (Exporter, error) {
+	dev, err := newSSHDevice("ssh-shell", options, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	opt, err := newShellOptions(options, "\n")
+	if err != nil {
+		return nil, fmt.Errorf("ssh-shell: %v", err)
+	}
+
+	sh := SSHShell{
+		SSHDevice:    dev,
+		shellOptions: *opt,
+		Term:         defaultShellTerm,
+		Width:        defaultShellWidth,
+	}
+
+	if t, _ := options.GetString("term"); t != "" {
+		sh.Term = t
+	}
+
+	if w, err := options.GetInt("term_width"); err == nil && w > 0 {
+		sh.Width = int(w)
+	}
+
+	if h, err := options.GetInt("term_height"); err == nil && h > 0 {
+		sh.Height = int(h)
+	}
+
+	list, _ := options["script"].([]interface{})
+
+	// Profile provides the default script
+	if len(list) == 0 && sh.Profile != nil {
+		if sh.Prompt == nil {
+			return nil, errors.New("ssh-shell: profile prompt missing")
+		}
+
+		// Wait for the prompt first
+		sh.Script = append([]*SSHShellStep{{
+			Expect:  sh.Prompt,
+			Timeout: sh.StepTimeout,
+		}}, commandScript(sh.Profile.DisablePaging, sh.Profile.Command, sh.Prompt, sh.StepTimeout)...)
+
+		// Skip banners and the pager command output
+		if sh.CaptureStart == nil {
+			sh.CaptureStart = captureAfter(sh.Profile.Command)
+		}
+
+		return &sh, nil
+	}
+
+	if len(list) == 0 {
+		return nil, errors.New("ssh-shell: script missing")
+	}
+
+	for i, v := range list {
+		step, err := newSSHShellStep(v, sh.StepTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("ssh-shell: step %d: %v", i, err)
+		}
+
+		sh.Script = append(sh.Script, step)
+	}
+
+	return &sh, nil
+}
+
+func init() {
+	registerExporter("ssh-shell", newSSHShell)
+}
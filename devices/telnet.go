@@ -0,0 +1,425 @@
+package devices
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/ecadlabs/rosdump/config"
+	"github.com/ecadlabs/rosdump/sshutils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultTelnetPort           = "23"
+	defaultTelnetUsernamePrompt = `(?i)(user ?name|login): ?$`
+	defaultTelnetPasswordPrompt = `(?i)password: ?$`
+)
+
+// Telnet protocol constants, see RFC 854, RFC 857 and RFC 858
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+
+	telnetOptEcho = 1
+	telnetOptSGA  = 3
+)
+
+// telnetConn handles option negotiation. Only remote echo and suppress-go-ahead are accepted
+type telnetConn struct {
+	net.Conn
+	rd     *bufio.Reader
+	state  int
+	cmd    byte
+	local  map[byte]bool
+	remote map[byte]bool
+	m      sync.Mutex
+}
+
+const (
+	telnetData = iota
+	telnetCommand
+	telnetOption
+	telnetSubneg
+	telnetSubnegIAC
+)
+
+func newTelnetConn(conn net.Conn) *telnetConn {
+	return &telnetConn{
+		Conn:   conn,
+		rd:     bufio.NewReader(conn),
+		local:  make(map[byte]bool),
+		remote: make(map[byte]bool),
+	}
+}
+
+func (t *telnetConn) command(cmd, opt byte) error {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	_, err := t.Conn.Write([]byte{telnetIAC, cmd, opt})
+	return err
+}
+
+func (t *telnetConn) negotiate(cmd, opt byte) error {
+	accept := opt == telnetOptEcho || opt == telnetOptSGA
+
+	switch cmd {
+	case telnetDO:
+		// We only suppress go-ahead
+		if opt == telnetOptSGA {
+			if !t.local[opt] {
+				t.local[opt] = true
+				return t.command(telnetWILL, opt)
+			}
+			return nil
+		}
+		return t.command(telnetWONT, opt)
+
+	case telnetDONT:
+		if t.local[opt] {
+			t.local[opt] = false
+			return t.command(telnetWONT, opt)
+		}
+
+	case telnetWILL:
+		if accept {
+			if !t.remote[opt] {
+				t.remote[opt] = true
+				return t.command(telnetDO, opt)
+			}
+			return nil
+		}
+		return t.command(telnetDONT, opt)
+
+	case telnetWONT:
+		if t.remote[opt] {
+			t.remote[opt] = false
+			return t.command(telnetDONT, opt)
+		}
+	}
+
+	return nil
+}
+
+func (t *telnetConn) Read(p []byte) (int, error) {
+	var n int
+
+	// Return as soon as some data is available
+	for n < len(p) && (n == 0 || t.rd.Buffered() != 0) {
+		c, err := t.rd.ReadByte()
+		if err != nil {
+			if n != 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+
+		switch t.state {
+		case telnetData:
+			if c == telnetIAC {
+				t.state = telnetCommand
+			} else {
+				p[n] = c
+				n++
+			}
+
+		case telnetCommand:
+			switch c {
+			case telnetIAC:
+				// Escaped 0xff
+				p[n] = c
+				n++
+				t.state = telnetData
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				t.cmd = c
+				t.state = telnetOption
+			case telnetSB:
+				t.state = telnetSubneg
+			default:
+				t.state = telnetData
+			}
+
+		case telnetOption:
+			t.state = telnetData
+			if err := t.negotiate(t.cmd, c); err != nil {
+				return n, err
+			}
+
+		case telnetSubneg:
+			if c == telnetIAC {
+				t.state = telnetSubnegIAC
+			}
+
+		case telnetSubnegIAC:
+			if c == telnetSE {
+				t.state = telnetData
+			} else {
+				t.state = telnetSubneg
+			}
+		}
+	}
+
+	return n, nil
+}
+
+func (t *telnetConn) Write(p []byte) (int, error) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	// Escape IAC
+	buf := bytes.Replace(p, []byte{telnetIAC}, []byte{telnetIAC, telnetIAC}, -1)
+	if _, err := t.Conn.Write(buf); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Telnet runs the command over an interactive telnet session. Plaintext protocol must be enabled explicitly
+type Telnet struct {
+	shellOptions
+	Name     string
+	Host     string
+	Port     string
+	Username string
+	Password string
+	// Command showing the configuration
+	Command        string
+	UsernamePrompt *regexp.Regexp
+	PasswordPrompt *regexp.Regexp
+	// Used to reach the device. net.Dialer is used if nil
+	Dialer sshutils.Dialer
+	// Limits connection establishment time if not zero
+	ConnectTimeout time.Duration
+	Logger         *logrus.Logger
+	ExportMetadata Metadata
+	DeviceMetadata Metadata
+}
+
+func (t *Telnet) address() string {
+	port := t.Port
+	if port == "" {
+		port = defaultTelnetPort
+	}
+
+	return net.JoinHostPort(t.Host, port)
+}
+
+func (t *Telnet) logger() *logrus.Entry {
+	return t.Logger.WithFields(logrus.Fields{
+		"name":    t.Name,
+		"address": t.address(),
+	})
+}
+
+func (t *Telnet) dial(ctx context.Context) (net.Conn, error) {
+	if t.ConnectTimeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.ConnectTimeout)
+		defer cancel()
+	}
+
+	var dialer sshutils.Dialer = &net.Dialer{}
+	if t.Dialer != nil {
+		dialer = t.Dialer
+	}
+
+	return dialer.DialContext(ctx, "tcp", t.address())
+}
+
+// login answers username and password prompts until the shell prompt is received
+func (t *Telnet) login(sh *shellSession) error {
+	var userSent, passSent bool
+
+	for {
+		i, err := sh.expectAny([]*regexp.Regexp{t.Prompt, t.UsernamePrompt, t.PasswordPrompt}, t.StepTimeout)
+		if err != nil {
+			return fmt.Errorf("login: %v", err)
+		}
+
+		switch i {
+		case 0:
+			return nil
+
+		case 1:
+			if userSent {
+				return errors.New("login failed")
+			}
+			userSent = true
+
+			if err := sh.write(t.Username); err != nil {
+				return err
+			}
+
+		case 2:
+			if passSent {
+				return errors.New("login failed")
+			}
+			passSent = true
+
+			if err := sh.write(t.Password); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (t *Telnet) Export(ctx context.Context) (response io.ReadCloser, metadata Metadata, err error) {
+	t.logger().Warnln("using plaintext telnet protocol")
+
+	conn, err := t.dial(ctx)
+	if err != nil {
+		return nil, t.ExportMetadata, fmt.Errorf("telnet: %v", err)
+	}
+	defer conn.Close()
+
+	// Deadline follows the context
+	if d, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(d)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	tc := newTelnetConn(conn)
+	sh := newShellSession(ctx, &t.shellOptions, tc, tc)
+	defer sh.Close()
+
+	if err := t.login(sh); err != nil {
+		return nil, t.ExportMetadata, fmt.Errorf("telnet: %v", err)
+	}
+
+	t.logger().Infof("issuing `%s' command...", t.Command)
+
+	var disablePaging string
+	if t.Profile != nil {
+		disablePaging = t.Profile.DisablePaging
+	}
+
+	if err := sh.run(commandScript(disablePaging, t.Command, t.Prompt, t.StepTimeout), t.logger()); err != nil {
+		return nil, t.ExportMetadata, fmt.Errorf("telnet: %v", err)
+	}
+
+	out, err := t.capture(sh.transcript.Bytes(), sh.sent)
+	if err != nil {
+		return nil, t.ExportMetadata, fmt.Errorf("telnet: %v", err)
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(out)), t.ExportMetadata, nil
+}
+
+func (t *Telnet) Metadata() Metadata {
+	return t.DeviceMetadata
+}
+
+func newTelnet(options config.Options, logger *logrus.Logger) (Exporter, error) {
+	if ok, _ := options.GetBool("allow_plaintext"); !ok {
+		return nil, errors.New("telnet: plaintext protocol must be enabled with allow_plaintext option")
+	}
+
+	opt, err := newShellOptions(options, "\r\n")
+	if err != nil {
+		return nil, fmt.Errorf("telnet: %v", err)
+	}
+
+	t := Telnet{
+		shellOptions: *opt,
+		Logger:       logger,
+	}
+
+	t.Name, _ = options.GetString("name")
+	t.Host, _ = options.GetString("host")
+	t.Port, _ = options.GetString("port")
+	t.Username, _ = options.GetString("username")
+	t.Password, _ = options.GetString("password")
+	t.Command, _ = options.GetString("command")
+
+	if t.Host == "" {
+		return nil, errors.New("telnet: address missing")
+	}
+
+	if t.Command == "" && t.Profile != nil {
+		t.Command = t.Profile.Command
+	}
+
+	if t.Command == "" {
+		return nil, errors.New("telnet: command missing")
+	}
+
+	if t.Prompt == nil {
+		return nil, errors.New("telnet: prompt missing")
+	}
+
+	if t.UsernamePrompt, err = getRegexp(options, "username_prompt"); err != nil {
+		return nil, fmt.Errorf("telnet: %v", err)
+	}
+	if t.UsernamePrompt == nil {
+		t.UsernamePrompt = regexp.MustCompile(defaultTelnetUsernamePrompt)
+	}
+
+	if t.PasswordPrompt, err = getRegexp(options, "password_prompt"); err != nil {
+		return nil, fmt.Errorf("telnet: %v", err)
+	}
+	if t.PasswordPrompt == nil {
+		t.PasswordPrompt = regexp.MustCompile(defaultTelnetPasswordPrompt)
+	}
+
+	if tm, _ := options.GetString("connect_timeout"); tm != "" {
+		if t.ConnectTimeout, err = time.ParseDuration(tm); err != nil {
+			return nil, fmt.Errorf("telnet: connect_timeout: %v", err)
+		}
+	}
+
+	if t.Dialer, err = newDialer(options); err != nil {
+		return nil, fmt.Errorf("telnet: %v", err)
+	}
+
+	// Skip the login banner
+	if t.CaptureStart == nil {
+		t.CaptureStart = captureAfter(t.Command)
+	}
+
+	// Filter out password
+	metadata := make(Metadata, len(options))
+	for k, v := range options {
+		if k != "password" {
+			metadata[k] = v
+		}
+	}
+	stripProxyCredentials(metadata)
+
+	t.ExportMetadata = metadata
+	t.DeviceMetadata = Metadata{
+		"name":   t.Name,
+		"host":   t.Host,
+		"device": "telnet",
+	}
+
+	return &t, nil
+}
+
+func init() {
+	registerExporter("telnet", newTelnet)
+}
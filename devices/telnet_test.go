@@ -0,0 +1,112 @@
+package devices
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+// telnetTestConn reads the server output from memory and records replies
+type telnetTestConn struct {
+	net.Conn
+	rd  io.Reader
+	out bytes.Buffer
+}
+
+func (t *telnetTestConn) Read(p []byte) (int, error)  { return t.rd.Read(p) }
+func (t *telnetTestConn) Write(p []byte) (int, error) { return t.out.Write(p) }
+
+func TestTelnetConn(t *testing.T) {
+	const (
+		optTTYPE = 24
+		optNAWS  = 31
+		nop      = 241
+	)
+
+	tests := []struct {
+		name    string
+		input   []byte
+		data    []byte
+		replies []byte
+	}{
+		{
+			name:  "plain",
+			input: []byte("Login: "),
+			data:  []byte("Login: "),
+		},
+		{
+			name:  "escaped IAC",
+			input: []byte{'a', telnetIAC, telnetIAC, 'b'},
+			data:  []byte{'a', telnetIAC, 'b'},
+		},
+		{
+			name:    "remote echo",
+			input:   []byte{'a', telnetIAC, telnetWILL, telnetOptEcho, 'b', telnetIAC, telnetWILL, telnetOptEcho},
+			data:    []byte("ab"),
+			replies: []byte{telnetIAC, telnetDO, telnetOptEcho},
+		},
+		{
+			name:    "remote options",
+			input:   []byte{telnetIAC, telnetWILL, telnetOptSGA, telnetIAC, telnetWILL, optNAWS},
+			replies: []byte{telnetIAC, telnetDO, telnetOptSGA, telnetIAC, telnetDONT, optNAWS},
+		},
+		{
+			name:    "local options",
+			input:   []byte{telnetIAC, telnetDO, telnetOptSGA, telnetIAC, telnetDO, optTTYPE, telnetIAC, telnetDO, telnetOptEcho},
+			replies: []byte{telnetIAC, telnetWILL, telnetOptSGA, telnetIAC, telnetWONT, optTTYPE, telnetIAC, telnetWONT, telnetOptEcho},
+		},
+		{
+			name:    "disable",
+			input:   []byte{telnetIAC, telnetDO, telnetOptSGA, telnetIAC, telnetDONT, telnetOptSGA, telnetIAC, telnetWILL, telnetOptEcho, telnetIAC, telnetWONT, telnetOptEcho, telnetIAC, telnetWONT, telnetOptEcho},
+			replies: []byte{telnetIAC, telnetWILL, telnetOptSGA, telnetIAC, telnetWONT, telnetOptSGA, telnetIAC, telnetDO, telnetOptEcho, telnetIAC, telnetDONT, telnetOptEcho},
+		},
+		{
+			name:  "subnegotiation",
+			input: []byte{'a', telnetIAC, telnetSB, optTTYPE, 1, telnetIAC, telnetIAC, telnetIAC, telnetSE, 'b'},
+			data:  []byte("ab"),
+		},
+		{
+			name:  "other command",
+			input: []byte{'a', telnetIAC, nop, 'b'},
+			data:  []byte("ab"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := telnetTestConn{rd: bytes.NewReader(test.input)}
+
+			data, err := ioutil.ReadAll(newTelnetConn(&conn))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(data, test.data) {
+				t.Errorf("got data %v, expected %v", data, test.data)
+			}
+
+			if !bytes.Equal(conn.out.Bytes(), test.replies) {
+				t.Errorf("got replies %v, expected %v", conn.out.Bytes(), test.replies)
+			}
+		})
+	}
+}
+
+func TestTelnetConnWrite(t *testing.T) {
+	conn := telnetTestConn{rd: bytes.NewReader(nil)}
+
+	n, err := newTelnetConn(&conn).Write([]byte{'a', telnetIAC, 'b'})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 3 {
+		t.Errorf("got %d bytes written", n)
+	}
+
+	if expected := []byte{'a', telnetIAC, telnetIAC, 'b'}; !bytes.Equal(conn.out.Bytes(), expected) {
+		t.Errorf("got %v, expected %v", conn.out.Bytes(), expected)
+	}
+}
@@ -0,0 +1,50 @@
+package devices
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+
+	"github.com/ecadlabs/rosdump/config"
+)
+
+// newTLSConfig builds TLS client configuration from ca_file, cert_file, key_file, server_name and insecure_skip_verify options
+func newTLSConfig(options config.Options) (*tls.Config, error) {
+	var conf tls.Config
+
+	conf.ServerName, _ = options.GetString("server_name")
+	conf.InsecureSkipVerify, _ = options.GetBool("insecure_skip_verify")
+
+	if caFile, _ := options.GetString("ca_file"); caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in CA file")
+		}
+
+		conf.RootCAs = pool
+	}
+
+	certFile, _ := options.GetString("cert_file")
+	keyFile, _ := options.GetString("key_file")
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("both cert_file and key_file must be specified")
+		}
+
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	return &conf, nil
+}
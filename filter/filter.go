@@ -31,3 +31,31 @@ func NewFilter(name string, options config.Options, logger *logrus.Logger) (Filt
 
 	return nil, fmt.Errorf("Unknown filter: `%s'", name)
 }
+
+// closeFilter closes the destination propagating the error if any. The source pipe is closed as well
+// so the preceding filter doesn't block on write
+func closeFilter(dst io.WriteCloser, src io.Reader, err error, name string, logger *logrus.Logger) {
+	if err == nil {
+		if e := dst.Close(); e != nil {
+			logger.Errorf("%s: %v", name, e)
+		}
+		return
+	}
+
+	if closer, ok := src.(closerWithError); ok {
+		closer.CloseWithError(err)
+	}
+
+	if closer, ok := dst.(closerWithError); ok {
+		// Propagate error
+		if e := closer.CloseWithError(err); e != nil {
+			logger.Errorf("%s: %v", name, e)
+		}
+		return
+	}
+
+	logger.Errorf("%s: %v", name, err)
+	if e := dst.Close(); e != nil {
+		logger.Errorf("%s: %v", name, e)
+	}
+}
@@ -0,0 +1,35 @@
+package filter
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/ecadlabs/rosdump/config"
+	"github.com/sirupsen/logrus"
+)
+
+func newTestFilter(t *testing.T, name string, options config.Options) Filter {
+	t.Helper()
+
+	f, err := NewFilter(name, options, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+// filterString passes the input through the filter
+func filterString(t *testing.T, f Filter, in string) (string, error) {
+	t.Helper()
+
+	r, w := io.Pipe()
+	if err := f.Start(w, strings.NewReader(in)); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := ioutil.ReadAll(r)
+	return string(out), err
+}
@@ -0,0 +1,214 @@
+package filter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/ecadlabs/rosdump/config"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	LineReplace   = iota // Replace matches
+	LineDrop             // Drop matching lines
+	LineKeep             // Drop lines not matching
+	LineDropBlock        // Drop lines between start and end
+)
+
+var lineActions = map[string]int{
+	"replace":    LineReplace,
+	"drop":       LineDrop,
+	"keep":       LineKeep,
+	"drop-block": LineDropBlock,
+}
+
+type LineRule struct {
+	Action int
+	// Block start for LineDropBlock
+	Regexp  *regexp.Regexp
+	Replace string
+	// Block end for LineDropBlock
+	End *regexp.Regexp
+	// The line ending the block is passed further
+	KeepEnd bool
+}
+
+// Lines applies the rules to each line in order. Line length is unlimited and line terminators are preserved
+type Lines struct {
+	Rules  []*LineRule
+	Logger *logrus.Logger
+}
+
+// apply returns the processed line and false if the line is dropped. Block state is kept per stream
+func (l *Lines) apply(line string, inBlock []bool) (string, bool) {
+	for i, r := range l.Rules {
+		switch r.Action {
+		case LineReplace:
+			line = r.Regexp.ReplaceAllString(line, r.Replace)
+
+		case LineDrop:
+			if r.Regexp.MatchString(line) {
+				return "", false
+			}
+
+		case LineKeep:
+			if !r.Regexp.MatchString(line) {
+				return "", false
+			}
+
+		case LineDropBlock:
+			if inBlock[i] {
+				if !r.End.MatchString(line) {
+					return "", false
+				}
+
+				inBlock[i] = false
+				if !r.KeepEnd {
+					return "", false
+				}
+			}
+
+			// The kept end line may start a new block
+			if r.Regexp.MatchString(line) {
+				inBlock[i] = true
+				return "", false
+			}
+		}
+	}
+
+	return line, true
+}
+
+func (l *Lines) filter(dst io.Writer, src io.Reader) error {
+	var (
+		rd      = bufio.NewReader(src)
+		wr      = bufio.NewWriter(dst)
+		inBlock = make([]bool, len(l.Rules))
+	)
+
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if line != "" {
+			var eol string
+			switch {
+			case strings.HasSuffix(line, "\r\n"):
+				eol = "\r\n"
+			case strings.HasSuffix(line, "\n"):
+				eol = "\n"
+			}
+
+			if out, ok := l.apply(line[:len(line)-len(eol)], inBlock); ok {
+				if _, err := wr.WriteString(out + eol); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err == io.EOF {
+			return wr.Flush()
+		}
+	}
+}
+
+func (l *Lines) Start(dst io.WriteCloser, src io.Reader) error {
+	go func() {
+		closeFilter(dst, src, l.filter(dst, src), "lines", l.Logger)
+	}()
+
+	return nil
+}
+
+func getLineRegexp(options config.Options, name string) (*regexp.Regexp, error) {
+	expr, _ := options.GetString(name)
+	if expr == "" {
+		return nil, fmt.Errorf("%s missing", name)
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	return re, nil
+}
+
+func newLineRule(options config.Options) (*LineRule, error) {
+	action, _ := options.GetString("action")
+
+	a, ok := lineActions[action]
+	if !ok {
+		return nil, fmt.Errorf("unknown action: `%s'", action)
+	}
+
+	r := LineRule{
+		Action: a,
+	}
+
+	var err error
+	if a == LineDropBlock {
+		if r.Regexp, err = getLineRegexp(options, "start"); err != nil {
+			return nil, err
+		}
+
+		if r.End, err = getLineRegexp(options, "end"); err != nil {
+			return nil, err
+		}
+
+		r.KeepEnd, _ = options.GetBool("keep_end")
+
+		return &r, nil
+	}
+
+	if r.Regexp, err = getLineRegexp(options, "expr"); err != nil {
+		return nil, err
+	}
+
+	r.Replace, _ = options.GetString("replace")
+
+	return &r, nil
+}
+
+func newLinesFilter(options config.Options, logger *logrus.Logger) (Filter, error) {
+	list, ok := options["rules"].([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, errors.New("lines: rules missing")
+	}
+
+	l := Lines{
+		Rules:  make([]*LineRule, len(list)),
+		Logger: logger,
+	}
+
+	for i, v := range list {
+		m, ok := v.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("lines: rule %d: map expected", i)
+		}
+
+		opt := make(config.Options, len(m))
+		for k, v := range m {
+			opt[fmt.Sprintf("%v", k)] = v
+		}
+
+		r, err := newLineRule(opt)
+		if err != nil {
+			return nil, fmt.Errorf("lines: rule %d: %v", i, err)
+		}
+
+		l.Rules[i] = r
+	}
+
+	return &l, nil
+}
+
+func init() {
+	registerFilter("lines", newLinesFilter)
+}
@@ -0,0 +1,101 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/ecadlabs/rosdump/config"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  []interface{}
+		input  string
+		output string
+	}{
+		{
+			name: "replace",
+			rules: []interface{}{
+				map[interface{}]interface{}{"action": "replace", "expr": `^# \S+ \S+ by (RouterOS)`, "replace": "# by $1"},
+			},
+			input:  "# jan/02/2024 10:00:00 by RouterOS 6.49.10\r\n/user\r\nlast",
+			output: "# by RouterOS 6.49.10\r\n/user\r\nlast",
+		},
+		{
+			name: "drop",
+			rules: []interface{}{
+				map[interface{}]interface{}{"action": "drop", "expr": "^# software id"},
+			},
+			input:  "# model = RB4011\n# software id = ABCD-1234\n/user\n",
+			output: "# model = RB4011\n/user\n",
+		},
+		{
+			name: "keep",
+			rules: []interface{}{
+				map[interface{}]interface{}{"action": "keep", "expr": "^add"},
+			},
+			input:  "/user\nadd name=a\nset 0 name=b\nadd name=c\n",
+			output: "add name=a\nadd name=c\n",
+		},
+		{
+			name: "drop block",
+			rules: []interface{}{
+				map[interface{}]interface{}{"action": "drop-block", "start": "^/system script", "end": "^/", "keep_end": true},
+			},
+			input:  "/user\nadd name=a\n/system script\nadd name=s1\n/system script\nadd name=s2\n/ip address\nadd address=10.0.0.1/24\n",
+			output: "/user\nadd name=a\n/ip address\nadd address=10.0.0.1/24\n",
+		},
+		{
+			name: "unterminated drop block",
+			rules: []interface{}{
+				map[interface{}]interface{}{"action": "drop-block", "start": "^BEGIN", "end": "^END"},
+			},
+			input:  "head\nBEGIN\nsecret\nmore",
+			output: "head\n",
+		},
+		{
+			name: "rules in order",
+			rules: []interface{}{
+				map[interface{}]interface{}{"action": "replace", "expr": "secret", "replace": "public"},
+				map[interface{}]interface{}{"action": "drop", "expr": "secret"},
+			},
+			input:  "a secret\n",
+			output: "a public\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newTestFilter(t, "lines", config.Options{"rules": test.rules})
+
+			out, err := filterString(t, f, test.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if out != test.output {
+				t.Errorf("got %q, expected %q", out, test.output)
+			}
+		})
+	}
+}
+
+func TestLinesOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules interface{}
+	}{
+		{name: "missing rules"},
+		{name: "unknown action", rules: []interface{}{map[interface{}]interface{}{"action": "foo", "expr": "x"}}},
+		{name: "missing end", rules: []interface{}{map[interface{}]interface{}{"action": "drop-block", "start": "x"}}},
+		{name: "invalid expression", rules: []interface{}{map[interface{}]interface{}{"action": "drop", "expr": "("}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewFilter("lines", config.Options{"rules": test.rules}, nil); err == nil {
+				t.Error("error expected")
+			}
+		})
+	}
+}
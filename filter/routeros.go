@@ -0,0 +1,547 @@
+package filter
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// RouterOS export parser shared by routeros-* filters
+
+const (
+	rosWord    = iota // Plain word or key=value pair
+	rosQuoted         // Quoted string
+	rosBracket        // Command substitution i.e. `[ find default=yes ]'
+)
+
+// rosToken is a command word. Start and End refer to the raw logical line
+type rosToken struct {
+	Kind int
+	// Property name if the token is key=value pair
+	Key string
+	// Decoded value with continuations and escapes removed
+	Value string
+	// Value was quoted
+	Quoted     bool
+	Start      int
+	ValueStart int
+	End        int
+}
+
+const (
+	rosBlank   = iota
+	rosComment // `#' comment
+	rosPath    // Menu path i.e. `/ip firewall filter'
+	rosCommand // Command i.e. `add address=192.168.88.1/24 interface=ether1'
+)
+
+// rosLine is a logical line possibly spanning several physical lines joined using `\' continuation
+type rosLine struct {
+	Kind int
+	// Raw line including continuations and line terminator
+	Raw string
+	// Menu path the command is applied to
+	Path string
+	// Command name i.e. `add' or `set'
+	Verb string
+	// Command arguments
+	Args []rosToken
+}
+
+// Commands terminating the path in `/path command args...' form
+var rosVerbs = map[string]bool{
+	"add":     true,
+	"set":     true,
+	"remove":  true,
+	"unset":   true,
+	"enable":  true,
+	"disable": true,
+	"move":    true,
+	"comment": true,
+	"reset":   true,
+}
+
+// rosReader reads logical lines. There is no line length limit
+type rosReader struct {
+	rd *bufio.Reader
+}
+
+func newROSReader(r io.Reader) *rosReader {
+	return &rosReader{rd: bufio.NewReader(r)}
+}
+
+// lineTerminator returns the length of the line terminator at the position or zero
+func lineTerminator(s string, i int) int {
+	switch {
+	case strings.HasPrefix(s[i:], "\r\n"):
+		return 2
+	case strings.HasPrefix(s[i:], "\n"):
+		return 1
+	}
+	return 0
+}
+
+// continues reports whether the physical line ends with `\' continuation. Quote state is carried between lines
+func continues(line string, quoted *bool) bool {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if i == len(line)-1 || lineTerminator(line, i+1) != 0 {
+				return true
+			}
+			// Escaped character
+			i++
+		case '"':
+			*quoted = !*quoted
+		}
+	}
+	return false
+}
+
+// ReadLine returns the next raw logical line. io.EOF is returned only if there is no data left
+func (r *rosReader) ReadLine() (string, error) {
+	var (
+		buf    strings.Builder
+		quoted bool
+	)
+
+	for {
+		line, err := r.rd.ReadString('\n')
+		buf.WriteString(line)
+
+		if err != nil {
+			if err == io.EOF && buf.Len() != 0 {
+				return buf.String(), nil
+			}
+			return buf.String(), err
+		}
+
+		// Comments aren't continued
+		if strings.HasPrefix(strings.TrimSpace(buf.String()), "#") || !continues(line, &quoted) {
+			return buf.String(), nil
+		}
+	}
+}
+
+// skipContinuation returns the position after `\' continuation and the indentation of the next line
+func skipContinuation(s string, i int) (int, bool) {
+	if s[i] != '\\' {
+		return i, false
+	}
+
+	n := lineTerminator(s, i+1)
+	if n == 0 {
+		return i, false
+	}
+
+	i += 1 + n
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+
+	return i, true
+}
+
+func isROSSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func fromHex(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	}
+	return 0, false
+}
+
+var rosEscapes = map[byte]byte{
+	'n': '\n',
+	'r': '\r',
+	't': '\t',
+	'a': '\a',
+	'b': '\b',
+	'f': '\f',
+	'v': '\v',
+	'_': ' ',
+}
+
+// contentEnd returns the length of the logical line without the trailing line terminator
+func contentEnd(s string) int {
+	switch {
+	case strings.HasSuffix(s, "\r\n"):
+		return len(s) - 2
+	case strings.HasSuffix(s, "\n"):
+		return len(s) - 1
+	}
+	return len(s)
+}
+
+// scanEscape decodes the escape sequence at the position and returns the position after it
+func scanEscape(buf *strings.Builder, s string, i, end int) int {
+	c := s[i+1]
+	i += 2
+
+	if hi, ok := fromHex(c); ok && i < end {
+		if lo, ok := fromHex(s[i]); ok {
+			buf.WriteByte(hi<<4 | lo)
+			return i + 1
+		}
+	}
+
+	if e, ok := rosEscapes[c]; ok {
+		c = e
+	}
+	buf.WriteByte(c)
+
+	return i
+}
+
+// scanQuoted decodes the quoted string starting at the position and returns the position after the closing quote.
+// Unterminated string ends before the line terminator
+func scanQuoted(s string, i int) (string, int) {
+	var (
+		buf strings.Builder
+		end = contentEnd(s)
+	)
+
+	i++ // Opening quote
+	for i < end {
+		if j, ok := skipContinuation(s, i); ok {
+			i = j
+			continue
+		}
+
+		switch c := s[i]; {
+		case c == '"':
+			return buf.String(), i + 1
+
+		case c == '\\' && i+1 < end:
+			i = scanEscape(&buf, s, i, end)
+
+		default:
+			buf.WriteByte(c)
+			i++
+		}
+	}
+
+	// Unterminated
+	return buf.String(), i
+}
+
+// scanBracket returns the bracket expression starting at the position with continuations removed. Unterminated
+// expression ends before the line terminator
+func scanBracket(s string, i int) (string, int) {
+	var (
+		buf   strings.Builder
+		depth int
+		end   = contentEnd(s)
+	)
+
+	for i < end {
+		if j, ok := skipContinuation(s, i); ok {
+			buf.WriteByte(' ')
+			i = j
+			continue
+		}
+
+		switch s[i] {
+		case '"':
+			start := i
+			_, i = scanQuoted(s, i)
+			buf.WriteString(s[start:i])
+			continue
+
+		case '[':
+			depth++
+
+		case ']':
+			depth--
+			if depth == 0 {
+				buf.WriteByte(']')
+				return buf.String(), i + 1
+			}
+		}
+
+		buf.WriteByte(s[i])
+		i++
+	}
+
+	return buf.String(), i
+}
+
+// scanWord decodes the unquoted word starting at the position
+func scanWord(s string, i int, stop byte) (string, int) {
+	var (
+		buf strings.Builder
+		end = contentEnd(s)
+	)
+
+	for i < end && !isROSSpace(s[i]) && s[i] != stop {
+		if j, ok := skipContinuation(s, i); ok {
+			i = j
+			continue
+		}
+
+		if s[i] == '\\' && i+1 < end {
+			i = scanEscape(&buf, s, i, end)
+			continue
+		}
+
+		buf.WriteByte(s[i])
+		i++
+	}
+
+	return buf.String(), i
+}
+
+// lexROS splits the raw logical line into tokens
+func lexROS(s string) []rosToken {
+	var tokens []rosToken
+
+	i := 0
+	for {
+		for i < len(s) {
+			if j, ok := skipContinuation(s, i); ok {
+				i = j
+			} else if isROSSpace(s[i]) {
+				i++
+			} else {
+				break
+			}
+		}
+
+		if i == len(s) {
+			break
+		}
+
+		t := rosToken{
+			Start:      i,
+			ValueStart: i,
+		}
+
+		switch s[i] {
+		case '"':
+			t.Kind = rosQuoted
+			t.Quoted = true
+			t.Value, i = scanQuoted(s, i)
+
+		case '[':
+			t.Kind = rosBracket
+			t.Value, i = scanBracket(s, i)
+
+		default:
+			t.Kind = rosWord
+			t.Value, i = scanWord(s, i, '=')
+
+			if i < len(s) && s[i] == '=' {
+				t.Key = t.Value
+				i++
+				// The line may be wrapped right after `='
+				for i < len(s) {
+					j, ok := skipContinuation(s, i)
+					if !ok {
+						break
+					}
+					i = j
+				}
+				t.ValueStart = i
+
+				switch {
+				case i < len(s) && s[i] == '"':
+					t.Quoted = true
+					t.Value, i = scanQuoted(s, i)
+				case i < len(s) && s[i] == '[':
+					t.Value, i = scanBracket(s, i)
+				default:
+					t.Value, i = scanWord(s, i, 0)
+				}
+			}
+		}
+
+		t.End = i
+		tokens = append(tokens, t)
+	}
+
+	return tokens
+}
+
+// rosParser keeps track of the current menu path
+type rosParser struct {
+	path string
+}
+
+func (p *rosParser) parse(raw string) *rosLine {
+	l := rosLine{
+		Raw:  raw,
+		Path: p.path,
+	}
+
+	trimmed := strings.TrimSpace(raw)
+	switch {
+	case trimmed == "":
+		l.Kind = rosBlank
+		return &l
+
+	case strings.HasPrefix(trimmed, "#"):
+		l.Kind = rosComment
+		return &l
+	}
+
+	tokens := lexROS(raw)
+
+	if strings.HasPrefix(trimmed, "/") {
+		// Menu path optionally followed by a command
+		var path []string
+		for len(tokens) != 0 && tokens[0].Kind == rosWord && tokens[0].Key == "" && !rosVerbs[tokens[0].Value] {
+			path = append(path, tokens[0].Value)
+			tokens = tokens[1:]
+		}
+
+		l.Path = strings.Join(path, " ")
+		if len(tokens) == 0 {
+			l.Kind = rosPath
+			p.path = l.Path
+			return &l
+		}
+	}
+
+	// Nothing but a continuation i.e. truncated export
+	if len(tokens) == 0 {
+		l.Kind = rosBlank
+		return &l
+	}
+
+	l.Kind = rosCommand
+	if tokens[0].Kind == rosWord && tokens[0].Key == "" {
+		l.Verb = tokens[0].Value
+		tokens = tokens[1:]
+	}
+	l.Args = tokens
+
+	return &l
+}
+
+// rosMenu returns the menu path in `/ip firewall filter' form. `/ip/firewall/filter' form is accepted too
+func rosMenu(path string) string {
+	if path == "" {
+		return ""
+	}
+	return "/" + strings.Join(strings.Fields(strings.Replace(path, "/", " ", -1)), " ")
+}
+
+// rosJoin removes `\' continuations and the indentation of continued lines keeping escapes intact
+func rosJoin(s string) string {
+	var buf strings.Builder
+
+	for i := 0; i < len(s); {
+		if j, ok := skipContinuation(s, i); ok {
+			i = j
+			continue
+		}
+
+		if s[i] == '\\' && i+1 < len(s) {
+			buf.WriteString(s[i : i+2])
+			i += 2
+			continue
+		}
+
+		buf.WriteByte(s[i])
+		i++
+	}
+
+	return buf.String()
+}
+
+// rosItem is a command along with preceding comments
+type rosItem struct {
+	*rosLine
+	Comments []string
+}
+
+// rosSection holds commands applied to the same menu path
+type rosSection struct {
+	Path  string
+	Items []*rosItem
+	// Comments not followed by a command
+	Trailer []string
+}
+
+// rosExport is a parsed RouterOS export. Each occurrence of a menu path starts a new section so the order of
+// commands is kept
+type rosExport struct {
+	// Leading comments
+	Header   []string
+	Sections []*rosSection
+}
+
+func parseROSExport(r io.Reader) (*rosExport, error) {
+	var (
+		ex       rosExport
+		rd       = newROSReader(r)
+		p        rosParser
+		comments []string
+		body     bool
+		last     *rosSection
+	)
+
+	section := func(path string) *rosSection {
+		last = &rosSection{Path: path}
+		ex.Sections = append(ex.Sections, last)
+		return last
+	}
+
+	for {
+		raw, err := rd.ReadLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		l := p.parse(raw)
+
+		switch l.Kind {
+		case rosComment:
+			if body {
+				comments = append(comments, strings.TrimSpace(raw))
+			} else {
+				ex.Header = append(ex.Header, strings.TrimSpace(raw))
+			}
+
+		case rosPath:
+			body = true
+			if last != nil {
+				last.Trailer = append(last.Trailer, comments...)
+				comments = nil
+			}
+			section(l.Path)
+
+		case rosCommand:
+			body = true
+			// Commands prefixed with another menu path don't change the current one
+			s := last
+			if s == nil || s.Path != l.Path {
+				s = section(l.Path)
+			}
+			s.Items = append(s.Items, &rosItem{
+				rosLine:  l,
+				Comments: comments,
+			})
+			comments = nil
+		}
+	}
+
+	if len(comments) != 0 {
+		if last == nil {
+			last = section("")
+		}
+		last.Trailer = append(last.Trailer, comments...)
+	}
+
+	return &ex, nil
+}
@@ -0,0 +1,184 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ecadlabs/rosdump/config"
+	"github.com/sirupsen/logrus"
+)
+
+// Menus where items are identified by their properties so the order of added items doesn't matter
+var rosUnorderedPaths = []string{
+	"/interface bridge port",
+	"/interface bridge vlan",
+	"/interface list",
+	"/interface list member",
+	"/interface vlan",
+	"/ip address",
+	"/ip dhcp-server lease",
+	"/ip dhcp-server network",
+	"/ip firewall address-list",
+	"/ip pool",
+	"/ip route",
+	"/ipv6 address",
+	"/ipv6 firewall address-list",
+	"/ipv6 route",
+	"/ppp secret",
+	"/system scheduler",
+	"/user",
+}
+
+// Volatile header lines i.e. `# jan/02/2024 10:00:00 by RouterOS 6.49.10' or `# software id = ABCD-1234'
+var rosVolatileHeader = []*regexp.Regexp{
+	regexp.MustCompile(`^#\s*$`),
+	regexp.MustCompile(`\bby RouterOS\b`),
+	regexp.MustCompile(`^#\s*software id\s*=`),
+}
+
+// RouterOSNormalizer rewrites RouterOS export in a canonical form: continued lines are joined, volatile header
+// is removed, arguments are sorted by name and consecutive `add' commands of unordered menus are sorted
+type RouterOSNormalizer struct {
+	Unordered map[string]bool
+	Logger    *logrus.Logger
+}
+
+// rosCanonical returns the command as a single line
+func rosCanonical(l *rosLine) string {
+	args := make([]string, 0, len(l.Args)+1)
+	if l.Verb != "" {
+		args = append(args, l.Verb)
+	}
+
+	// Positional arguments first, script commands are left as is
+	tokens := append([]rosToken(nil), l.Args...)
+	if rosVerbs[l.Verb] {
+		sort.SliceStable(tokens, func(i, j int) bool {
+			if (tokens[i].Key == "") != (tokens[j].Key == "") {
+				return tokens[i].Key == ""
+			}
+			return tokens[i].Key < tokens[j].Key
+		})
+	}
+
+	for _, t := range tokens {
+		args = append(args, rosJoin(l.Raw[t.Start:t.End]))
+	}
+
+	return strings.Join(args, " ")
+}
+
+func (r *RouterOSNormalizer) filter(dst io.Writer, src io.Reader) error {
+	ex, err := parseROSExport(src)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(dst)
+
+	for _, h := range ex.Header {
+		var volatile bool
+		for _, re := range rosVolatileHeader {
+			if re.MatchString(h) {
+				volatile = true
+				break
+			}
+		}
+
+		if !volatile {
+			fmt.Fprintln(w, h)
+		}
+	}
+
+	for _, s := range ex.Sections {
+		type item struct {
+			line     string
+			comments []string
+		}
+
+		items := make([]item, len(s.Items))
+		for i, it := range s.Items {
+			items[i] = item{
+				line:     rosCanonical(it.rosLine),
+				comments: it.Comments,
+			}
+		}
+
+		// Other commands i.e. `set [ find default=yes ]' may depend on the preceding items
+		if r.Unordered[rosMenu(s.Path)] {
+			for i := 0; i < len(items); {
+				j := i
+				for j < len(items) && s.Items[j].Verb == "add" {
+					j++
+				}
+
+				if j == i {
+					i++
+					continue
+				}
+
+				run := items[i:j]
+				sort.SliceStable(run, func(a, b int) bool { return run[a].line < run[b].line })
+				i = j
+			}
+		}
+
+		if s.Path != "" {
+			fmt.Fprintln(w, s.Path)
+		}
+
+		for _, it := range items {
+			for _, c := range it.comments {
+				fmt.Fprintln(w, c)
+			}
+			fmt.Fprintln(w, it.line)
+		}
+
+		for _, c := range s.Trailer {
+			fmt.Fprintln(w, c)
+		}
+	}
+
+	return w.Flush()
+}
+
+func (r *RouterOSNormalizer) Start(dst io.WriteCloser, src io.Reader) error {
+	go func() {
+		closeFilter(dst, src, r.filter(dst, src), "routeros-normalize", r.Logger)
+	}()
+
+	return nil
+}
+
+func newRouterOSNormalizer(options config.Options, logger *logrus.Logger) (Filter, error) {
+	r := RouterOSNormalizer{
+		Unordered: make(map[string]bool),
+		Logger:    logger,
+	}
+
+	for _, p := range rosUnorderedPaths {
+		r.Unordered[p] = true
+	}
+
+	var list []interface{}
+	switch v := options["unordered"].(type) {
+	case string:
+		list = []interface{}{v}
+	case []interface{}:
+		list = v
+	}
+
+	for _, v := range list {
+		r.Unordered[rosMenu(fmt.Sprintf("%v", v))] = true
+	}
+
+	return &r, nil
+}
+
+func init() {
+	registerFilter("routeros-normalize", newRouterOSNormalizer)
+}
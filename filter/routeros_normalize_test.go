@@ -0,0 +1,76 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/ecadlabs/rosdump/config"
+)
+
+func TestRouterOSNormalizer(t *testing.T) {
+	tests := []struct {
+		name    string
+		options config.Options
+		input   string
+		output  string
+	}{
+		{
+			name:   "header",
+			input:  "# jan/02/2024 10:00:00 by RouterOS 6.49.10\n# software id = ABCD-1234\n#\n# model = RB4011\n/user\nadd name=a\n",
+			output: "# model = RB4011\n/user\nadd name=a\n",
+		},
+		{
+			name:   "continuation and argument order",
+			input:  "/interface bridge\nadd name=bridge1 \\\n    comment=\"a \\\"b\\\"\" \\\n    auto-mac=no\n",
+			output: "/interface bridge\nadd auto-mac=no comment=\"a \\\"b\\\"\" name=bridge1\n",
+		},
+		{
+			name:   "find first",
+			input:  "/interface ethernet\nset comment=WAN [ find default-name=ether1 ]\n",
+			output: "/interface ethernet\nset [ find default-name=ether1 ] comment=WAN\n",
+		},
+		{
+			name:   "unordered add runs",
+			input:  "/ip pool\nadd name=z ranges=2\n# pool a\nadd name=a ranges=1\nset [ find name=a ] ranges=3\nadd name=y ranges=4\nadd name=b ranges=5\n",
+			output: "/ip pool\n# pool a\nadd name=a ranges=1\nadd name=z ranges=2\nset [ find name=a ] ranges=3\nadd name=b ranges=5\nadd name=y ranges=4\n",
+		},
+		{
+			name:   "ordered menu",
+			input:  "/ip firewall filter\nadd chain=input action=drop\nadd chain=forward action=accept\n",
+			output: "/ip firewall filter\nadd action=drop chain=input\nadd action=accept chain=forward\n",
+		},
+		{
+			name:    "unordered option",
+			options: config.Options{"unordered": []interface{}{"/ip/firewall/filter"}},
+			input:   "/ip firewall filter\nadd chain=z\nadd chain=a\n",
+			output:  "/ip firewall filter\nadd chain=a\nadd chain=z\n",
+		},
+		{
+			name:   "repeated menus",
+			input:  "/ip address\nadd address=10.0.0.2/24\n/interface bridge\nadd name=b1\n/ip address\nadd address=10.0.0.1/24\n",
+			output: "/ip address\nadd address=10.0.0.2/24\n/interface bridge\nadd name=b1\n/ip address\nadd address=10.0.0.1/24\n",
+		},
+		{
+			name:   "dollar",
+			input:  "/ppp secret\nadd password=\"p\\$ss\" name=u\n",
+			output: "/ppp secret\nadd name=u password=\"p\\$ss\"\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := test.options
+			if options == nil {
+				options = config.Options{}
+			}
+
+			out, err := filterString(t, newTestFilter(t, "routeros-normalize", options), test.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if out != test.output {
+				t.Errorf("got %q, expected %q", out, test.output)
+			}
+		})
+	}
+}
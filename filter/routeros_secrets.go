@@ -0,0 +1,173 @@
+package filter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ecadlabs/rosdump/config"
+	"github.com/sirupsen/logrus"
+)
+
+const rosMaskPrefix = "MASKED-"
+
+// Properties holding secrets in any menu
+var rosSecretProperties = []string{
+	"auth-key",
+	"authentication-key",
+	"authentication-password",
+	"encryption-password",
+	"ipsec-secret",
+	"management-protection-key",
+	"passphrase",
+	"password",
+	"pre-shared-key",
+	"preshared-key",
+	"private-key",
+	"secret",
+	"secrets",
+	"static-key-0",
+	"static-key-1",
+	"static-key-2",
+	"static-key-3",
+	"static-sta-private-key",
+	"tcp-md5-key",
+	"wpa-pre-shared-key",
+	"wpa2-pre-shared-key",
+}
+
+// Menu specific properties holding secrets
+var rosSecretPathProperties = map[string][]string{
+	// SNMP v1/v2c community name is the secret itself
+	"/snmp community": {"name"},
+}
+
+// RouterOSSecrets replaces secret property values in RouterOS export with keyed hashes
+type RouterOSSecrets struct {
+	Key        []byte
+	Properties map[string]bool
+	Logger     *logrus.Logger
+}
+
+func (r *RouterOSSecrets) mask(value string) string {
+	h := hmac.New(sha256.New, r.Key)
+	h.Write([]byte(value))
+	return rosMaskPrefix + hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+func (r *RouterOSSecrets) isSecret(path, key string) bool {
+	// i.e. `security.passphrase'
+	if i := strings.LastIndexByte(key, '.'); i >= 0 {
+		key = key[i+1:]
+	}
+
+	if r.Properties[key] {
+		return true
+	}
+
+	for _, p := range rosSecretPathProperties[path] {
+		if p == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// maskLine replaces values keeping the rest of the line intact
+func (r *RouterOSSecrets) maskLine(l *rosLine) string {
+	if l.Kind != rosCommand {
+		return l.Raw
+	}
+
+	var (
+		buf strings.Builder
+		pos int
+	)
+
+	for _, t := range l.Args {
+		if t.Key == "" || t.Value == "" || !r.isSecret(l.Path, t.Key) {
+			continue
+		}
+
+		buf.WriteString(l.Raw[pos:t.ValueStart])
+		buf.WriteString(r.mask(t.Value))
+		pos = t.End
+	}
+
+	buf.WriteString(l.Raw[pos:])
+
+	return buf.String()
+}
+
+func (r *RouterOSSecrets) filter(dst io.Writer, src io.Reader) error {
+	var (
+		rd = newROSReader(src)
+		p  rosParser
+	)
+
+	for {
+		raw, err := rd.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(dst, r.maskLine(p.parse(raw))); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *RouterOSSecrets) Start(dst io.WriteCloser, src io.Reader) error {
+	go func() {
+		closeFilter(dst, src, r.filter(dst, src), "routeros-secrets", r.Logger)
+	}()
+
+	return nil
+}
+
+func newRouterOSSecretsFilter(options config.Options, logger *logrus.Logger) (Filter, error) {
+	key, err := options.GetSecret("key")
+	if err != nil && err != config.ErrOptNotFound {
+		return nil, fmt.Errorf("routeros-secrets: %v", err)
+	}
+
+	if key == "" {
+		return nil, errors.New("routeros-secrets: key missing")
+	}
+
+	r := RouterOSSecrets{
+		Key:        []byte(key),
+		Properties: make(map[string]bool),
+		Logger:     logger,
+	}
+
+	for _, p := range rosSecretProperties {
+		r.Properties[p] = true
+	}
+
+	var list []interface{}
+	switch v := options["properties"].(type) {
+	case string:
+		list = []interface{}{v}
+	case []interface{}:
+		list = v
+	}
+
+	for _, v := range list {
+		r.Properties[fmt.Sprintf("%v", v)] = true
+	}
+
+	return &r, nil
+}
+
+func init() {
+	registerFilter("routeros-secrets", newRouterOSSecretsFilter)
+}
@@ -0,0 +1,72 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/ecadlabs/rosdump/config"
+)
+
+func TestRouterOSSecrets(t *testing.T) {
+	f := newTestFilter(t, "routeros-secrets", config.Options{"key": "k"})
+	m := f.(*RouterOSSecrets).mask
+
+	tests := []struct {
+		name   string
+		input  string
+		output string
+	}{
+		{
+			name:   "plain",
+			input:  "/ppp secret\nadd name=user1 password=pass service=pppoe\n",
+			output: "/ppp secret\nadd name=user1 password=" + m("pass") + " service=pppoe\n",
+		},
+		{
+			name:   "dollar",
+			input:  "/ppp secret\nadd name=user1 password=p\\$ss\nadd name=user2 password=\"p\\$ss\"\n",
+			output: "/ppp secret\nadd name=user1 password=" + m("p$ss") + "\nadd name=user2 password=" + m("p$ss") + "\n",
+		},
+		{
+			name:   "escaped quotes",
+			input:  "add wpa2-pre-shared-key=\"my \\\"secret\\\" key\" mode=dynamic-keys\n",
+			output: "add wpa2-pre-shared-key=" + m(`my "secret" key`) + " mode=dynamic-keys\n",
+		},
+		{
+			name:   "continuation",
+			input:  "add name=prof1 \\\r\n    security.passphrase=\"long \\\r\n    phrase\" ssid=x\r\n",
+			output: "add name=prof1 \\\r\n    security.passphrase=" + m("long phrase") + " ssid=x\r\n",
+		},
+		{
+			name:   "unterminated quote",
+			input:  "add secret=\"open\nadd secret=x\n",
+			output: "add secret=" + m("open") + "\nadd secret=" + m("x") + "\n",
+		},
+		{
+			name:   "snmp community",
+			input:  "/snmp community\nset [ find default=yes ] name=public123\n/user\nadd name=admin\n",
+			output: "/snmp community\nset [ find default=yes ] name=" + m("public123") + "\n/user\nadd name=admin\n",
+		},
+		{
+			name:   "empty value and comment",
+			input:  "# password=x\nadd password=\"\"\n",
+			output: "# password=x\nadd password=\"\"\n",
+		},
+		{
+			name:   "script source",
+			input:  "/system script\nadd name=s1 source=\"/ppp secret add password=x\"\n",
+			output: "/system script\nadd name=s1 source=\"/ppp secret add password=x\"\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := filterString(t, f, test.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if out != test.output {
+				t.Errorf("got %q, expected %q", out, test.output)
+			}
+		})
+	}
+}
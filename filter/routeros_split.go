@@ -0,0 +1,102 @@
+package filter
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// RouterOSHeaderSection is the name of the section holding leading comments and commands preceding the first menu path
+const RouterOSHeaderSection = "header"
+
+// RouterOSSection is a part of RouterOS export holding a single menu
+type RouterOSSection struct {
+	// Menu path i.e. `/ip firewall filter'. Empty for the header
+	Path string
+	// Name usable as a file name i.e. `ip_firewall_filter'. Repeated menus are numbered starting from the second
+	// occurrence i.e. `ip_firewall_filter.2'
+	Name string
+	Data []byte
+}
+
+var rosSectionNameReplacer = strings.NewReplacer(" ", "_", "/", "_")
+
+func rosSectionName(path string) string {
+	if path == "" {
+		return RouterOSHeaderSection
+	}
+	return rosSectionNameReplacer.Replace(strings.TrimPrefix(path, "/"))
+}
+
+func writeLine(buf *bytes.Buffer, line string) {
+	buf.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		buf.WriteByte('\n')
+	}
+}
+
+// SplitRouterOS splits RouterOS export into menu sections in the export order. Each occurrence of a menu path
+// is a separate section, lines are kept intact
+func SplitRouterOS(r io.Reader) ([]*RouterOSSection, error) {
+	ex, err := parseROSExport(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		sections []*RouterOSSection
+		names    = make(map[string]int)
+	)
+
+	// Header goes along with commands lacking the path
+	var header bytes.Buffer
+	for _, h := range ex.Header {
+		writeLine(&header, h)
+	}
+
+	for _, s := range ex.Sections {
+		var buf *bytes.Buffer
+		if s.Path == "" {
+			buf = &header
+		} else {
+			buf = new(bytes.Buffer)
+			writeLine(buf, s.Path)
+		}
+
+		for _, it := range s.Items {
+			for _, c := range it.Comments {
+				writeLine(buf, c)
+			}
+			writeLine(buf, it.Raw)
+		}
+
+		for _, c := range s.Trailer {
+			writeLine(buf, c)
+		}
+
+		if s.Path != "" {
+			// `/ip/address' and `/ip address' share the name too
+			name := rosSectionName(s.Path)
+			names[name]++
+			if n := names[name]; n > 1 {
+				name += "." + strconv.Itoa(n)
+			}
+
+			sections = append(sections, &RouterOSSection{
+				Path: s.Path,
+				Name: name,
+				Data: buf.Bytes(),
+			})
+		}
+	}
+
+	if header.Len() != 0 {
+		sections = append([]*RouterOSSection{{
+			Name: RouterOSHeaderSection,
+			Data: header.Bytes(),
+		}}, sections...)
+	}
+
+	return sections, nil
+}
@@ -0,0 +1,42 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitRouterOS(t *testing.T) {
+	const input = "# model = RB4011\n" +
+		"/interface bridge\n" +
+		"add name=bridge1 \\\n    comment=\"first\"\n" +
+		"/ip firewall filter\n" +
+		"add chain=input\n" +
+		"/interface bridge\n" +
+		"add name=bridge0\n" +
+		"/ip/firewall/filter\n" +
+		"add chain=forward\n"
+
+	expected := []RouterOSSection{
+		{Name: "header", Data: []byte("# model = RB4011\n")},
+		{Path: "/interface bridge", Name: "interface_bridge", Data: []byte("/interface bridge\nadd name=bridge1 \\\n    comment=\"first\"\n")},
+		{Path: "/ip firewall filter", Name: "ip_firewall_filter", Data: []byte("/ip firewall filter\nadd chain=input\n")},
+		{Path: "/interface bridge", Name: "interface_bridge.2", Data: []byte("/interface bridge\nadd name=bridge0\n")},
+		{Path: "/ip/firewall/filter", Name: "ip_firewall_filter.2", Data: []byte("/ip/firewall/filter\nadd chain=forward\n")},
+	}
+
+	sections, err := SplitRouterOS(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sections) != len(expected) {
+		t.Fatalf("got %d sections, expected %d", len(sections), len(expected))
+	}
+
+	for i, s := range sections {
+		e := expected[i]
+		if s.Path != e.Path || s.Name != e.Name || string(s.Data) != string(e.Data) {
+			t.Errorf("section %d: got %s %s %q, expected %s %s %q", i, s.Path, s.Name, s.Data, e.Path, e.Name, e.Data)
+		}
+	}
+}
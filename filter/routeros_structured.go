@@ -0,0 +1,144 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ecadlabs/rosdump/config"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// RouterOSStructured converts RouterOS export into a JSON or YAML document: menu path -> list of commands
+type RouterOSStructured struct {
+	// json or yaml
+	Format string
+	Logger *logrus.Logger
+}
+
+type rosStructuredItem struct {
+	// Command name i.e. `add' or `set'
+	Command string `json:"command" yaml:"command"`
+	// Selector i.e. `[ find default-name=ether1 ]'
+	Find map[string]string `json:"find,omitempty" yaml:"find,omitempty"`
+	// Other positional arguments
+	Args       []string          `json:"args,omitempty" yaml:"args,omitempty"`
+	Properties map[string]string `json:"properties,omitempty" yaml:"properties,omitempty"`
+}
+
+// parseFind returns properties of `[ find key=value ... ]' selector
+func parseFind(expr string) (map[string]string, bool) {
+	if !strings.HasPrefix(expr, "[") || !strings.HasSuffix(expr, "]") {
+		return nil, false
+	}
+
+	tokens := lexROS(expr[1 : len(expr)-1])
+	if len(tokens) == 0 || tokens[0].Key != "" || tokens[0].Value != "find" {
+		return nil, false
+	}
+
+	find := make(map[string]string, len(tokens)-1)
+	for _, t := range tokens[1:] {
+		if t.Key == "" {
+			return nil, false
+		}
+		find[t.Key] = t.Value
+	}
+
+	return find, true
+}
+
+func (r *RouterOSStructured) filter(dst io.Writer, src io.Reader) error {
+	ex, err := parseROSExport(src)
+	if err != nil {
+		return err
+	}
+
+	doc := make(map[string][]*rosStructuredItem, len(ex.Sections))
+
+	for _, s := range ex.Sections {
+		if len(s.Items) == 0 {
+			continue
+		}
+
+		items := make([]*rosStructuredItem, len(s.Items))
+
+		for i, it := range s.Items {
+			item := rosStructuredItem{
+				Command: it.Verb,
+			}
+
+			for _, t := range it.Args {
+				if t.Key != "" {
+					if item.Properties == nil {
+						item.Properties = make(map[string]string)
+					}
+					item.Properties[t.Key] = t.Value
+					continue
+				}
+
+				if t.Kind == rosBracket && item.Find == nil {
+					if find, ok := parseFind(t.Value); ok {
+						item.Find = find
+						continue
+					}
+				}
+
+				item.Args = append(item.Args, t.Value)
+			}
+
+			items[i] = &item
+		}
+
+		// Repeated menu paths are appended in the export order
+		doc[s.Path] = append(doc[s.Path], items...)
+	}
+
+	// Both encoders sort map keys so the output is deterministic
+	var out []byte
+	switch r.Format {
+	case "yaml":
+		out, err = yaml.Marshal(doc)
+
+	default:
+		out, err = json.MarshalIndent(doc, "", "  ")
+		out = append(out, '\n')
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = dst.Write(out)
+	return err
+}
+
+func (r *RouterOSStructured) Start(dst io.WriteCloser, src io.Reader) error {
+	go func() {
+		closeFilter(dst, src, r.filter(dst, src), "routeros-structured", r.Logger)
+	}()
+
+	return nil
+}
+
+func newRouterOSStructured(options config.Options, logger *logrus.Logger) (Filter, error) {
+	r := RouterOSStructured{
+		Logger: logger,
+	}
+
+	r.Format, _ = options.GetString("format")
+
+	switch r.Format {
+	case "", "json", "yaml":
+	default:
+		return nil, fmt.Errorf("routeros-structured: unknown format: `%s'", r.Format)
+	}
+
+	return &r, nil
+}
+
+func init() {
+	registerFilter("routeros-structured", newRouterOSStructured)
+}
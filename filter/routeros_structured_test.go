@@ -0,0 +1,63 @@
+package filter
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/ecadlabs/rosdump/config"
+)
+
+func TestRouterOSStructured(t *testing.T) {
+	const input = `# model = RB4011
+/interface ethernet
+set [ find default-name=ether1 ] comment="WAN \"uplink\""
+/ppp secret
+add name=user1 password="p\$ss" \
+    service=pppoe
+/interface ethernet
+set [ find default-name=ether2 ] disabled=yes
+/ip address add address=10.0.0.1/24 interface=ether2
+`
+
+	expected := map[string][]*rosStructuredItem{
+		"/interface ethernet": {
+			{
+				Command:    "set",
+				Find:       map[string]string{"default-name": "ether1"},
+				Properties: map[string]string{"comment": `WAN "uplink"`},
+			},
+			{
+				Command:    "set",
+				Find:       map[string]string{"default-name": "ether2"},
+				Properties: map[string]string{"disabled": "yes"},
+			},
+		},
+		"/ppp secret": {
+			{
+				Command:    "add",
+				Properties: map[string]string{"name": "user1", "password": "p$ss", "service": "pppoe"},
+			},
+		},
+		"/ip address": {
+			{
+				Command:    "add",
+				Properties: map[string]string{"address": "10.0.0.1/24", "interface": "ether2"},
+			},
+		},
+	}
+
+	out, err := filterString(t, newTestFilter(t, "routeros-structured", config.Options{}), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc map[string][]*rosStructuredItem
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("got %s", out)
+	}
+}
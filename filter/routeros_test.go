@@ -0,0 +1,286 @@
+package filter
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ecadlabs/rosdump/config"
+)
+
+func TestLexROS(t *testing.T) {
+	type token struct {
+		Key, Value string
+		Quoted     bool
+		// Raw value
+		Raw string
+	}
+
+	tests := []struct {
+		name   string
+		line   string
+		tokens []token
+	}{
+		{
+			name: "plain",
+			line: "add disabled=no name=bridge1\n",
+			tokens: []token{
+				{Value: "add", Raw: "add"},
+				{Key: "disabled", Value: "no", Raw: "no"},
+				{Key: "name", Value: "bridge1", Raw: "bridge1"},
+			},
+		},
+		{
+			name: "escaped quotes",
+			line: `add comment="say \"hi\"" name=a` + "\n",
+			tokens: []token{
+				{Value: "add", Raw: "add"},
+				{Key: "comment", Value: `say "hi"`, Quoted: true, Raw: `"say \"hi\""`},
+				{Key: "name", Value: "a", Raw: "a"},
+			},
+		},
+		{
+			name: "dollar",
+			line: `add password=p\$ss secret="s\$1"` + "\n",
+			tokens: []token{
+				{Value: "add", Raw: "add"},
+				{Key: "password", Value: "p$ss", Raw: `p\$ss`},
+				{Key: "secret", Value: "s$1", Quoted: true, Raw: `"s\$1"`},
+			},
+		},
+		{
+			name: "escapes",
+			line: `add source="a\r\n\tb\41\_"` + "\n",
+			tokens: []token{
+				{Value: "add", Raw: "add"},
+				{Key: "source", Value: "a\r\n\tbA ", Quoted: true, Raw: `"a\r\n\tb\41\_"`},
+			},
+		},
+		{
+			name: "continuation",
+			line: "add name=a \\\n    comment=\"long \\\n    text\"\n",
+			tokens: []token{
+				{Value: "add", Raw: "add"},
+				{Key: "name", Value: "a", Raw: "a"},
+				{Key: "comment", Value: "long text", Quoted: true, Raw: "\"long \\\n    text\""},
+			},
+		},
+		{
+			name: "continuation after equals sign",
+			line: "add comment=\\\n    \"x y\"\r\n",
+			tokens: []token{
+				{Value: "add", Raw: "add"},
+				{Key: "comment", Value: "x y", Quoted: true, Raw: `"x y"`},
+			},
+		},
+		{
+			name: "find",
+			line: "set [ find default-name=ether1 ] comment=WAN\n",
+			tokens: []token{
+				{Value: "set", Raw: "set"},
+				{Value: "[ find default-name=ether1 ]", Raw: "[ find default-name=ether1 ]"},
+				{Key: "comment", Value: "WAN", Raw: "WAN"},
+			},
+		},
+		{
+			name: "unterminated quote",
+			line: "add comment=\"open\r\n",
+			tokens: []token{
+				{Value: "add", Raw: "add"},
+				{Key: "comment", Value: "open", Quoted: true, Raw: `"open`},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var tokens []token
+			for _, tok := range lexROS(test.line) {
+				tokens = append(tokens, token{
+					Key:    tok.Key,
+					Value:  tok.Value,
+					Quoted: tok.Quoted,
+					Raw:    test.line[tok.ValueStart:tok.End],
+				})
+			}
+
+			if !reflect.DeepEqual(tokens, test.tokens) {
+				t.Errorf("got %+v, expected %+v", tokens, test.tokens)
+			}
+		})
+	}
+}
+
+func TestROSReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		lines []string
+	}{
+		{
+			name:  "continuation",
+			input: "/ip address\nadd address=10.0.0.1/24 \\\n    interface=ether1\nadd address=10.0.0.2/24\n",
+			lines: []string{"/ip address\n", "add address=10.0.0.1/24 \\\n    interface=ether1\n", "add address=10.0.0.2/24\n"},
+		},
+		{
+			name:  "escaped backslash",
+			input: "add comment=\"a\\\\\"\nadd\n",
+			lines: []string{"add comment=\"a\\\\\"\n", "add\n"},
+		},
+		{
+			name:  "comment",
+			input: "# not continued \\\nadd\n",
+			lines: []string{"# not continued \\\n", "add\n"},
+		},
+		{
+			name:  "no terminator",
+			input: "add\r\nset",
+			lines: []string{"add\r\n", "set"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				rd    = newROSReader(strings.NewReader(test.input))
+				lines []string
+			)
+
+			for {
+				l, err := rd.ReadLine()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				lines = append(lines, l)
+			}
+
+			if !reflect.DeepEqual(lines, test.lines) {
+				t.Errorf("got %q, expected %q", lines, test.lines)
+			}
+		})
+	}
+}
+
+func TestParseROSExport(t *testing.T) {
+	const input = `# model = RB4011
+/interface bridge
+add name=bridge1
+/ip address
+# lan
+add address=10.0.0.1/24 interface=bridge1
+/interface bridge add name=bridge2
+add address=10.0.0.2/24 interface=bridge1
+/interface bridge
+add name=bridge0
+# trailing
+`
+
+	type section struct {
+		Path     string
+		Lines    []string
+		Comments []string
+		Trailer  []string
+	}
+
+	ex, err := parseROSExport(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sections []section
+	for _, s := range ex.Sections {
+		sec := section{
+			Path:    s.Path,
+			Trailer: s.Trailer,
+		}
+		for _, it := range s.Items {
+			sec.Lines = append(sec.Lines, strings.TrimSpace(it.Raw))
+			sec.Comments = append(sec.Comments, it.Comments...)
+		}
+		sections = append(sections, sec)
+	}
+
+	// Each occurrence of a menu is kept in place
+	expected := []section{
+		{Path: "/interface bridge", Lines: []string{"add name=bridge1"}},
+		{Path: "/ip address", Lines: []string{"add address=10.0.0.1/24 interface=bridge1"}, Comments: []string{"# lan"}},
+		{Path: "/interface bridge", Lines: []string{"/interface bridge add name=bridge2"}},
+		{Path: "/ip address", Lines: []string{"add address=10.0.0.2/24 interface=bridge1"}},
+		{Path: "/interface bridge", Lines: []string{"add name=bridge0"}, Trailer: []string{"# trailing"}},
+	}
+
+	if !reflect.DeepEqual(ex.Header, []string{"# model = RB4011"}) {
+		t.Errorf("header: got %q", ex.Header)
+	}
+
+	if !reflect.DeepEqual(sections, expected) {
+		t.Errorf("got %+v, expected %+v", sections, expected)
+	}
+}
+
+func TestParseROSContinuationOnly(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		lines []string
+	}{
+		{
+			name:  "continuation only line",
+			input: "/ip address\n\\\nadd address=10.0.0.1/24\n",
+			lines: []string{"\\\nadd address=10.0.0.1/24"},
+		},
+		{
+			name:  "truncated after continuation",
+			input: "/ip address\nadd address=10.0.0.1/24\n\\\n",
+			lines: []string{"add address=10.0.0.1/24"},
+		},
+		{
+			name:  "truncated command",
+			input: "/ip address\nadd address=10.0.0.1/24 \\",
+			lines: []string{"add address=10.0.0.1/24 \\"},
+		},
+	}
+
+	filters := []struct {
+		name    string
+		options config.Options
+	}{
+		{name: "routeros-secrets", options: config.Options{"key": "k"}},
+		{name: "routeros-normalize", options: config.Options{}},
+		{name: "routeros-structured", options: config.Options{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ex, err := parseROSExport(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var lines []string
+			for _, s := range ex.Sections {
+				for _, it := range s.Items {
+					lines = append(lines, strings.TrimSpace(it.Raw))
+				}
+			}
+
+			if !reflect.DeepEqual(lines, test.lines) {
+				t.Errorf("got %q, expected %q", lines, test.lines)
+			}
+
+			for _, f := range filters {
+				if _, err := filterString(t, newTestFilter(t, f.name, f.options), test.input); err != nil {
+					t.Errorf("%s: %v", f.name, err)
+				}
+			}
+
+			if _, err := SplitRouterOS(strings.NewReader(test.input)); err != nil {
+				t.Errorf("split: %v", err)
+			}
+		})
+	}
+}
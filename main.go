@@ -17,7 +17,9 @@ func runScraper(ctx context.Context, s *scraper.Scraper, timeout time.Duration)
 	log.Info("collecting data...")
 
 	if timeout != 0 {
-		ctx, _ = context.WithTimeout(ctx, timeout)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
 	return s.Do(ctx)
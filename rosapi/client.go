@@ -0,0 +1,171 @@
+package rosapi
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	Username string
+	Password string
+	// Use API-SSL if not nil
+	TLSConfig *tls.Config
+}
+
+type Client struct {
+	conn net.Conn
+	rd   *bufio.Reader
+	m    sync.Mutex
+}
+
+func (c *Client) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Run sends the command and collects replies until `!done'. `!trap' and `!fatal' replies are returned as *Error
+func (c *Client) Run(words ...string) ([]*Sentence, error) {
+	if len(words) == 0 {
+		return nil, errEmptyCommand
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if err := writeSentence(c.conn, words); err != nil {
+		return nil, err
+	}
+
+	var (
+		res     []*Sentence
+		trapErr error
+	)
+
+	for {
+		s, err := readSentence(c.rd)
+		if err != nil {
+			return nil, err
+		}
+
+		switch s.Reply {
+		case "!re":
+			res = append(res, s)
+
+		case "!done":
+			if trapErr != nil {
+				return nil, trapErr
+			}
+			return append(res, s), nil
+
+		case "!empty":
+			// RouterOS 7.18+ marks a reply without data, `!done' still terminates it
+
+		case "!trap":
+			// `!done' follows
+			if trapErr == nil {
+				trapErr = newError(s)
+			}
+
+		case "!fatal":
+			return nil, newError(s)
+
+		default:
+			return nil, fmt.Errorf("rosapi: unexpected reply: `%s'", s.Reply)
+		}
+	}
+}
+
+func (c *Client) login(conf *Config) error {
+	res, err := c.Run("/login", "=name="+conf.Username, "=password="+conf.Password)
+	if err != nil {
+		return err
+	}
+
+	ret, ok := res[len(res)-1].Get("ret")
+	if !ok {
+		return nil
+	}
+
+	// Pre 6.43 challenge-response login
+	challenge, err := hex.DecodeString(ret)
+	if err != nil {
+		return fmt.Errorf("rosapi: login: %v", err)
+	}
+
+	h := md5.New()
+	h.Write([]byte{0})
+	h.Write([]byte(conf.Password))
+	h.Write(challenge)
+
+	_, err = c.Run("/login", "=name="+conf.Username, "=response=00"+hex.EncodeToString(h.Sum(nil)))
+	return err
+}
+
+func Dial(ctx context.Context, address string, c *Config) (client *Client, err error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
+
+	if d, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(d)
+	}
+
+	if c.TLSConfig != nil {
+		conf := c.TLSConfig.Clone()
+		if conf.ServerName == "" && !conf.InsecureSkipVerify {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return nil, err
+			}
+			conf.ServerName = host
+		}
+
+		conn = tls.Client(conn, conf)
+	}
+
+	client = &Client{
+		conn: conn,
+		rd:   bufio.NewReader(conn),
+	}
+
+	ch := make(chan struct{})
+
+	go func() {
+		err = client.login(c)
+		close(ch)
+	}()
+
+	select {
+	case <-ctx.Done():
+		conn.SetDeadline(time.Now())
+		<-ch
+		return nil, ctx.Err()
+
+	case <-ch:
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	return client, nil
+}
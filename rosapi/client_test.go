@@ -0,0 +1,180 @@
+package rosapi
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// apiExchange is a command expected by the fake device and its replies
+type apiExchange struct {
+	command []string
+	replies [][]string
+}
+
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	var words []string
+	for {
+		l, err := readLength(rd)
+		if err != nil {
+			return nil, err
+		}
+
+		if l == 0 {
+			return words, nil
+		}
+
+		buf := make([]byte, l)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		words = append(words, string(buf))
+	}
+}
+
+// newTestClient returns a client connected to the fake device over an in-memory pipe
+func newTestClient(t *testing.T, exchanges []apiExchange) *Client {
+	c, s := net.Pipe()
+
+	go func() {
+		defer s.Close()
+
+		rd := bufio.NewReader(s)
+		for _, ex := range exchanges {
+			cmd, err := readCommand(rd)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if !reflect.DeepEqual(cmd, ex.command) {
+				t.Errorf("got command %q, expected %q", cmd, ex.command)
+				return
+			}
+
+			for _, r := range ex.replies {
+				if err := writeSentence(s, r); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}
+	}()
+
+	return &Client{
+		conn: c,
+		rd:   bufio.NewReader(c),
+	}
+}
+
+func TestClientRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		replies [][]string
+		result  []string
+		err     string
+	}{
+		{
+			name:    "print",
+			replies: [][]string{{"!re", "=address=10.0.0.1/24"}, {"!re", "=address=10.0.0.2/24"}, {"!done"}},
+			result:  []string{"!re =address=10.0.0.1/24", "!re =address=10.0.0.2/24", "!done"},
+		},
+		{
+			name:    "empty",
+			replies: [][]string{{"!empty"}, {"!done"}},
+			result:  []string{"!done"},
+		},
+		{
+			name:    "trap",
+			replies: [][]string{{"!trap", "=category=0", "=message=no such command"}, {"!done"}},
+			err:     "rosapi: !trap: no such command (category 0)",
+		},
+		{
+			name:    "fatal",
+			replies: [][]string{{"!fatal", "session terminated on request"}},
+			err:     "rosapi: !fatal: session terminated on request",
+		},
+		{
+			name:    "unexpected reply",
+			replies: [][]string{{"!what"}},
+			err:     "rosapi: unexpected reply: `!what'",
+		},
+	}
+
+	command := []string{"/ip/address/print", "?disabled=false"}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newTestClient(t, []apiExchange{{command: command, replies: test.replies}})
+			defer c.Close()
+
+			res, err := c.Run(command...)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("got error %v, expected %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var result []string
+			for _, s := range res {
+				result = append(result, s.String())
+			}
+
+			if !reflect.DeepEqual(result, test.result) {
+				t.Errorf("got %q, expected %q", result, test.result)
+			}
+		})
+	}
+}
+
+func TestClientLogin(t *testing.T) {
+	challenge := []byte("0123456789abcdef")
+	h := md5.Sum(append(append([]byte{0}, "secret"...), challenge...))
+
+	tests := []struct {
+		name      string
+		exchanges []apiExchange
+		err       bool
+	}{
+		{
+			name: "plain",
+			exchanges: []apiExchange{
+				{command: []string{"/login", "=name=admin", "=password=secret"}, replies: [][]string{{"!done"}}},
+			},
+		},
+		{
+			name: "challenge",
+			exchanges: []apiExchange{
+				{command: []string{"/login", "=name=admin", "=password=secret"}, replies: [][]string{{"!done", "=ret=" + hex.EncodeToString(challenge)}}},
+				{command: []string{"/login", "=name=admin", "=response=00" + hex.EncodeToString(h[:])}, replies: [][]string{{"!done"}}},
+			},
+		},
+		{
+			name: "failure",
+			exchanges: []apiExchange{
+				{command: []string{"/login", "=name=admin", "=password=secret"}, replies: [][]string{{"!trap", "=message=invalid user name or password (6)"}, {"!done"}}},
+			},
+			err: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newTestClient(t, test.exchanges)
+			defer c.Close()
+
+			err := c.login(&Config{Username: "admin", Password: "secret"})
+			if (err != nil) != test.err {
+				t.Errorf("got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package rosapi
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Attribute is a single `=key=value' word of a sentence
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// Sentence is a reply sentence: reply word (`!re', `!done', `!trap' or `!fatal'),
+// optional tag and attribute words in order of appearance
+type Sentence struct {
+	Reply      string
+	Tag        string
+	Attributes []Attribute
+}
+
+// Get returns value of the first attribute with the given key
+func (s *Sentence) Get(key string) (string, bool) {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			return a.Value, true
+		}
+	}
+
+	return "", false
+}
+
+func (s *Sentence) String() string {
+	words := make([]string, 0, len(s.Attributes)+1)
+	words = append(words, s.Reply)
+	for _, a := range s.Attributes {
+		words = append(words, "="+a.Key+"="+a.Value)
+	}
+	return strings.Join(words, " ")
+}
+
+const maxWordLength = 1 << 28 // Sane limit
+
+func encodeLength(l int) []byte {
+	switch {
+	case l < 0x80:
+		return []byte{byte(l)}
+	case l < 0x4000:
+		return []byte{byte(l>>8) | 0x80, byte(l)}
+	case l < 0x200000:
+		return []byte{byte(l>>16) | 0xc0, byte(l >> 8), byte(l)}
+	case l < 0x10000000:
+		return []byte{byte(l>>24) | 0xe0, byte(l >> 16), byte(l >> 8), byte(l)}
+	default:
+		return []byte{0xf0, byte(l >> 24), byte(l >> 16), byte(l >> 8), byte(l)}
+	}
+}
+
+func readLength(rd *bufio.Reader) (int, error) {
+	b, err := rd.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		l     int
+		extra int
+	)
+
+	switch {
+	case b&0x80 == 0:
+		return int(b), nil
+	case b&0xc0 == 0x80:
+		l, extra = int(b&0x3f), 1
+	case b&0xe0 == 0xc0:
+		l, extra = int(b&0x1f), 2
+	case b&0xf0 == 0xe0:
+		l, extra = int(b&0x0f), 3
+	case b == 0xf0:
+		l, extra = 0, 4
+	default:
+		return 0, fmt.Errorf("rosapi: invalid length prefix: %#02x", b)
+	}
+
+	for i := 0; i < extra; i++ {
+		if b, err = rd.ReadByte(); err != nil {
+			return 0, err
+		}
+		l = l<<8 | int(b)
+	}
+
+	return l, nil
+}
+
+func writeSentence(w io.Writer, words []string) error {
+	wr := bufio.NewWriter(w)
+
+	for _, word := range words {
+		if _, err := wr.Write(encodeLength(len(word))); err != nil {
+			return err
+		}
+
+		if _, err := wr.WriteString(word); err != nil {
+			return err
+		}
+	}
+
+	// Terminating zero length word
+	if err := wr.WriteByte(0); err != nil {
+		return err
+	}
+
+	return wr.Flush()
+}
+
+func readSentence(rd *bufio.Reader) (*Sentence, error) {
+	var s Sentence
+
+	for {
+		l, err := readLength(rd)
+		if err != nil {
+			return nil, err
+		}
+
+		if l == 0 {
+			if s.Reply == "" {
+				// Empty sentence, skip
+				continue
+			}
+			return &s, nil
+		}
+
+		if l > maxWordLength {
+			return nil, fmt.Errorf("rosapi: word is too long: %d", l)
+		}
+
+		buf := make([]byte, l)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		word := string(buf)
+
+		switch {
+		case s.Reply == "":
+			if !strings.HasPrefix(word, "!") {
+				return nil, fmt.Errorf("rosapi: unexpected reply word: `%s'", word)
+			}
+			s.Reply = word
+
+		case strings.HasPrefix(word, ".tag="):
+			s.Tag = word[5:]
+
+		case strings.HasPrefix(word, "="):
+			kv := strings.SplitN(word[1:], "=", 2)
+			a := Attribute{Key: kv[0]}
+			if len(kv) == 2 {
+				a.Value = kv[1]
+			}
+			s.Attributes = append(s.Attributes, a)
+
+		default:
+			// RouterOS 6 returns `!fatal' reason as a bare word
+			s.Attributes = append(s.Attributes, Attribute{Key: "message", Value: word})
+		}
+	}
+}
+
+// Error is returned when the device replies with `!trap' or `!fatal'
+type Error struct {
+	Reply    string
+	Message  string
+	Category string
+}
+
+func (e *Error) Error() string {
+	if e.Category != "" {
+		return fmt.Sprintf("rosapi: %s: %s (category %s)", e.Reply, e.Message, e.Category)
+	}
+	return fmt.Sprintf("rosapi: %s: %s", e.Reply, e.Message)
+}
+
+func newError(s *Sentence) *Error {
+	e := Error{Reply: s.Reply}
+	e.Message, _ = s.Get("message")
+	e.Category, _ = s.Get("category")
+	return &e
+}
+
+var errEmptyCommand = errors.New("rosapi: empty command")
@@ -0,0 +1,126 @@
+package rosapi
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLength(t *testing.T) {
+	tests := []struct {
+		length  int
+		encoded []byte
+	}{
+		{length: 0, encoded: []byte{0x00}},
+		{length: 0x7f, encoded: []byte{0x7f}},
+		{length: 0x80, encoded: []byte{0x80, 0x80}},
+		{length: 0x3fff, encoded: []byte{0xbf, 0xff}},
+		{length: 0x4000, encoded: []byte{0xc0, 0x40, 0x00}},
+		{length: 0x1fffff, encoded: []byte{0xdf, 0xff, 0xff}},
+		{length: 0x200000, encoded: []byte{0xe0, 0x20, 0x00, 0x00}},
+		{length: 0xfffffff, encoded: []byte{0xef, 0xff, 0xff, 0xff}},
+		{length: 0x10000000, encoded: []byte{0xf0, 0x10, 0x00, 0x00, 0x00}},
+	}
+
+	for _, test := range tests {
+		enc := encodeLength(test.length)
+		if !bytes.Equal(enc, test.encoded) {
+			t.Errorf("%#x: got %x, expected %x", test.length, enc, test.encoded)
+		}
+
+		l, err := readLength(bufio.NewReader(bytes.NewReader(test.encoded)))
+		if err != nil {
+			t.Errorf("%#x: %v", test.length, err)
+		} else if l != test.length {
+			t.Errorf("%x: got %#x, expected %#x", test.encoded, l, test.length)
+		}
+	}
+
+	if _, err := readLength(bufio.NewReader(bytes.NewReader([]byte{0xf8}))); err == nil {
+		t.Error("invalid prefix accepted")
+	}
+}
+
+// encodeWords encodes words as a single sentence
+func encodeWords(words ...string) []byte {
+	var buf bytes.Buffer
+	if err := writeSentence(&buf, words); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadSentence(t *testing.T) {
+	long := strings.Repeat("x", 0x4000)
+
+	tests := []struct {
+		name     string
+		input    []byte
+		sentence *Sentence
+		err      bool
+	}{
+		{
+			name:  "attributes",
+			input: encodeWords("!re", "=address=10.0.0.1/24", "=comment=a=b c", "=disabled"),
+			sentence: &Sentence{
+				Reply: "!re",
+				Attributes: []Attribute{
+					{Key: "address", Value: "10.0.0.1/24"},
+					{Key: "comment", Value: "a=b c"},
+					{Key: "disabled"},
+				},
+			},
+		},
+		{
+			name:     "tag",
+			input:    encodeWords("!done", ".tag=7"),
+			sentence: &Sentence{Reply: "!done", Tag: "7"},
+		},
+		{
+			name:     "empty sentence skipped",
+			input:    append([]byte{0}, encodeWords("!done")...),
+			sentence: &Sentence{Reply: "!done"},
+		},
+		{
+			name:     "long word",
+			input:    encodeWords("!re", "=ret="+long),
+			sentence: &Sentence{Reply: "!re", Attributes: []Attribute{{Key: "ret", Value: long}}},
+		},
+		{
+			name:     "bare fatal reason",
+			input:    encodeWords("!fatal", "not logged in"),
+			sentence: &Sentence{Reply: "!fatal", Attributes: []Attribute{{Key: "message", Value: "not logged in"}}},
+		},
+		{
+			name:  "not a reply",
+			input: encodeWords("=ret=x"),
+			err:   true,
+		},
+		{
+			name:  "truncated",
+			input: encodeWords("!re", "=address=10.0.0.1/24")[:8],
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := readSentence(bufio.NewReader(bytes.NewReader(test.input)))
+			if test.err {
+				if err == nil {
+					t.Errorf("expected error, got %v", s)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(s, test.sentence) {
+				t.Errorf("got %+v, expected %+v", s, test.sentence)
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/ecadlabs/rosdump/config"
 	"github.com/ecadlabs/rosdump/devices"
 	"github.com/ecadlabs/rosdump/filter"
+	"github.com/ecadlabs/rosdump/sshutils"
 	"github.com/ecadlabs/rosdump/storage"
 	"github.com/sirupsen/logrus"
 )
@@ -22,7 +23,19 @@ const (
 type Exporter struct {
 	Device  devices.Exporter
 	Filters []filter.Filter
-	Timeout time.Duration
+	// Optional outputs stored separately
+	Outputs []*Output
+	// Store each RouterOS menu separately
+	SplitSections bool
+	Timeout       time.Duration
+}
+
+// Output is an additional filter chain applied to the filtered stream. Output name is passed to the storage
+// as `output' metadata field
+type Output struct {
+	Name          string
+	Filters       []filter.Filter
+	SplitSections bool
 }
 
 type Scraper struct {
@@ -33,26 +46,33 @@ type Scraper struct {
 	Logger         *logrus.Logger
 }
 
-func (s *Scraper) storageCtx(parent context.Context) context.Context {
+func (s *Scraper) storageCtx(parent context.Context) (context.Context, context.CancelFunc) {
 	if s.StorageTimeout != 0 {
-		ctx, _ := context.WithTimeout(parent, s.StorageTimeout)
-		return ctx
+		return context.WithTimeout(parent, s.StorageTimeout)
 	}
 
-	return parent
+	return context.WithCancel(parent)
 }
 
-func (s *Scraper) export(ctx context.Context, dev *Exporter, tx storage.Tx, l *logrus.Entry) (err error) {
-	var exportCtx context.Context
-	if dev.Timeout != 0 {
-		exportCtx, _ = context.WithTimeout(ctx, dev.Timeout)
-	} else {
-		exportCtx = ctx
+// filterChain passes the stream through the filters
+func filterChain(src io.Reader, filters []filter.Filter) (io.Reader, error) {
+	for _, f := range filters {
+		r, w := io.Pipe()
+
+		if err := f.Start(w, src); err != nil {
+			return nil, err
+		}
+
+		src = r
 	}
 
-	l.Infoln("exporting...")
+	return src, nil
+}
+
+// store passes the stream through the filter chain to the storage. Export error is recorded in the storage
+func (s *Scraper) store(ctx context.Context, dev *Exporter, tx storage.Tx, data io.ReadCloser, metadata devices.Metadata, exportErr error, l *logrus.Entry) (err error) {
+	err = exportErr
 
-	data, metadata, err := dev.Device.Export(exportCtx)
 	if metadata == nil {
 		metadata = make(devices.Metadata, 1)
 	}
@@ -66,9 +86,20 @@ func (s *Scraper) export(ctx context.Context, dev *Exporter, tx storage.Tx, l *l
 		}()
 	}
 
+	if len(dev.Outputs) != 0 {
+		return s.storeOutputs(ctx, dev, tx, data, metadata, err, l)
+	}
+
 	l.Infoln("adding stream to transaction...")
 
-	wr, e := tx.Add(s.storageCtx(ctx), metadata)
+	sctx, cancel := s.storageCtx(ctx)
+	defer cancel()
+
+	if dev.SplitSections {
+		tx = &sectionTx{Tx: tx, logger: l}
+	}
+
+	wr, e := tx.Add(sctx, metadata)
 	if e != nil {
 		if err == nil {
 			return e
@@ -83,30 +114,175 @@ func (s *Scraper) export(ctx context.Context, dev *Exporter, tx storage.Tx, l *l
 		return err
 	}
 
-	// Build filter chain
+	src, err := filterChain(data, dev.Filters)
+	if err != nil {
+		wr.CloseWithError(err)
+		return err
+	}
+
+	_, err = io.Copy(wr, src)
+
+	if e := wr.CloseWithError(err); e != nil {
+		if err == nil {
+			return e
+		}
+	}
+
+	return err
+}
+
+// storeOutputs copies the filtered stream to each output's filter chain. Failure of any output fails all of them
+func (s *Scraper) storeOutputs(ctx context.Context, dev *Exporter, tx storage.Tx, data io.Reader, metadata devices.Metadata, err error, l *logrus.Entry) error {
+	sctx, cancel := s.storageCtx(ctx)
+	defer cancel()
+
+	writers := make([]storage.WriteCloserWithError, 0, len(dev.Outputs))
+
+	for _, o := range dev.Outputs {
+		ol := l.WithField("output", o.Name)
+		ol.Infoln("adding stream to transaction...")
+
+		otx := tx
+		if o.SplitSections {
+			otx = &sectionTx{Tx: tx, logger: ol}
+		}
+
+		wr, e := otx.Add(sctx, metadata.Append(devices.Metadata{
+			"output": o.Name,
+		}))
+
+		if e != nil {
+			if err == nil {
+				err = e
+			} else {
+				l.Errorln(e)
+			}
+			break
+		}
+
+		writers = append(writers, wr)
+	}
+
+	var src io.Reader
+	if err == nil {
+		src, err = filterChain(data, dev.Filters)
+	}
+
+	if err != nil {
+		for _, wr := range writers {
+			wr.CloseWithError(err)
+		}
+		return err
+	}
+
+	var (
+		wg    sync.WaitGroup
+		pipes = make([]io.Writer, len(writers))
+		errs  = make([]error, len(writers))
+	)
 
-	var src io.Reader = data
-	for _, f := range dev.Filters {
+	for i, wr := range writers {
 		r, w := io.Pipe()
+		pipes[i] = w
 
-		if err := f.Start(w, src); err != nil {
-			return err
+		out, e := filterChain(r, dev.Outputs[i].Filters)
+		if e != nil {
+			r.CloseWithError(e)
+			errs[i] = e
+			continue
 		}
 
-		src = r
+		wg.Add(1)
+		go func(i int, wr io.Writer, r *io.PipeReader, out io.Reader) {
+			_, errs[i] = io.Copy(wr, out)
+			// Unblock the writer
+			r.CloseWithError(errs[i])
+			wg.Done()
+		}(i, wr, r, out)
 	}
 
-	_, err = io.Copy(wr, src)
+	_, err = io.Copy(io.MultiWriter(pipes...), src)
+
+	for _, w := range pipes {
+		w.(*io.PipeWriter).CloseWithError(err)
+	}
+
+	wg.Wait()
+
+	for i, wr := range writers {
+		e := errs[i]
+		if e == nil {
+			e = err
+		}
+
+		if ce := wr.CloseWithError(e); ce != nil && e == nil {
+			e = ce
+		}
 
-	if e := wr.CloseWithError(err); e != nil {
 		if err == nil {
-			return e
+			err = e
 		}
 	}
 
 	return err
 }
 
+func (s *Scraper) exportArtifacts(ctx, exportCtx context.Context, dev *Exporter, m devices.MultiExporter, tx storage.Tx, l *logrus.Entry) error {
+	ar, metadata, err := m.ExportArtifacts(exportCtx)
+	if err != nil {
+		return s.store(ctx, dev, tx, nil, metadata, err, l)
+	}
+	defer ar.Close()
+
+	var total, failed int
+
+	for {
+		name, data, err := ar.Next()
+		if err == io.EOF {
+			break
+		}
+
+		al := l.WithField("artifact", name)
+		md := metadata.Append(devices.Metadata{
+			"artifact": name,
+		})
+
+		total++
+		if err := s.store(ctx, dev, tx, data, md, err, al); err != nil {
+			al.Errorln(err)
+			failed++
+		}
+
+		if exportCtx.Err() != nil {
+			break
+		}
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("%d of %d artifacts failed", failed, total)
+	}
+
+	return nil
+}
+
+func (s *Scraper) export(ctx context.Context, dev *Exporter, tx storage.Tx, l *logrus.Entry) (err error) {
+	exportCtx := ctx
+	if dev.Timeout != 0 {
+		var cancel context.CancelFunc
+		exportCtx, cancel = context.WithTimeout(ctx, dev.Timeout)
+		defer cancel()
+	}
+
+	l.Infoln("exporting...")
+
+	if m, ok := dev.Device.(devices.MultiExporter); ok {
+		return s.exportArtifacts(ctx, exportCtx, dev, m, tx, l)
+	}
+
+	data, metadata, err := dev.Device.Export(exportCtx)
+	return s.store(ctx, dev, tx, data, metadata, err, l)
+}
+
 func (s *Scraper) exportLoop(ctx context.Context, ch <-chan *Exporter, tx storage.Tx) {
 	for d := range ch {
 		l := s.Logger.WithFields(logrus.Fields(d.Device.Metadata()))
@@ -124,11 +300,17 @@ func (s *Scraper) exportLoop(ctx context.Context, ch <-chan *Exporter, tx storag
 }
 
 func (s *Scraper) Do(ctx context.Context) error {
-	tx, err := s.Storage.Begin(s.storageCtx(ctx))
+	bctx, cancel := s.storageCtx(ctx)
+	tx, err := s.Storage.Begin(bctx)
+	cancel()
 	if err != nil {
 		return err
 	}
 
+	// Jump host connections are shared between devices during the run
+	pool := sshutils.NewPool()
+	exportCtx := sshutils.WithPool(ctx, pool)
+
 	gnum := len(s.Devices)
 	if s.MaxGoroutines > 0 && gnum > s.MaxGoroutines {
 		gnum = s.MaxGoroutines
@@ -141,7 +323,7 @@ func (s *Scraper) Do(ctx context.Context) error {
 
 	for i := 0; i < gnum; i++ {
 		go func() {
-			s.exportLoop(ctx, ch, tx)
+			s.exportLoop(exportCtx, ch, tx)
 			wg.Done()
 		}()
 	}
@@ -158,6 +340,10 @@ jobLoop:
 	close(ch)
 	wg.Wait()
 
+	if err := pool.Close(); err != nil {
+		s.Logger.Errorln(err)
+	}
+
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
@@ -166,7 +352,10 @@ jobLoop:
 
 	s.Logger.Infoln("committing...")
 
-	if err := tx.Commit(s.storageCtx(ctx)); err != nil {
+	cctx, cancel := s.storageCtx(ctx)
+	defer cancel()
+
+	if err := tx.Commit(cctx); err != nil {
 		return err
 	}
 
@@ -174,6 +363,82 @@ jobLoop:
 	return nil
 }
 
+func getFilters(val interface{}, declared map[string]filter.Filter) ([]filter.Filter, error) {
+	var names []string
+
+	switch v := val.(type) {
+	case string:
+		names = []string{v}
+	case []interface{}:
+		names = make([]string, 0, len(v))
+		for _, vv := range v {
+			if s, ok := vv.(string); ok {
+				names = append(names, s)
+			}
+		}
+	}
+
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	filters := make([]filter.Filter, len(names))
+
+	for i, name := range names {
+		f, ok := declared[name]
+		if !ok {
+			return nil, fmt.Errorf("Filter `%s' is not declared", name)
+		}
+
+		filters[i] = f
+	}
+
+	return filters, nil
+}
+
+func getOutputs(val interface{}, declared map[string]filter.Filter) ([]*Output, error) {
+	if val == nil {
+		return nil, nil
+	}
+
+	list, ok := val.([]interface{})
+	if !ok {
+		return nil, errors.New("outputs: array expected")
+	}
+
+	outputs := make([]*Output, len(list))
+	names := make(map[string]struct{}, len(list))
+
+	for i, v := range list {
+		m, ok := v.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("outputs: item %d: map expected", i)
+		}
+
+		var o Output
+		o.Name, _ = m["name"].(string)
+		if o.Name == "" {
+			return nil, fmt.Errorf("outputs: item %d: name missing", i)
+		}
+
+		if _, ok := names[o.Name]; ok {
+			return nil, fmt.Errorf("outputs: duplicate name `%s'", o.Name)
+		}
+		names[o.Name] = struct{}{}
+
+		var err error
+		if o.Filters, err = getFilters(m["filters"], declared); err != nil {
+			return nil, fmt.Errorf("outputs: %s: %v", o.Name, err)
+		}
+
+		o.SplitSections, _ = m["split_sections"].(bool)
+
+		outputs[i] = &o
+	}
+
+	return outputs, nil
+}
+
 func New(c *config.Config, logger *logrus.Logger) (*Scraper, error) {
 	// Init filters
 	declaredFilters := make(map[string]filter.Filter, len(c.Filters))
@@ -190,11 +455,26 @@ func New(c *config.Config, logger *logrus.Logger) (*Scraper, error) {
 		declaredFilters[f.Name] = filter
 	}
 
+	for name, opt := range c.Profiles {
+		if err := devices.RegisterProfile(name, opt); err != nil {
+			return nil, err
+		}
+	}
+
 	// Init drivers
-	var devCommon config.Options
+	devCommon := make(config.Options, len(c.Devices.Common)+2)
 
-	if c.Devices.Common != nil {
-		devCommon = c.Devices.Common
+	// Global defaults are overridden by common and per-device options
+	if c.BindAddress != "" {
+		devCommon["bind_address"] = c.BindAddress
+	}
+
+	if c.BindInterface != "" {
+		devCommon["bind_interface"] = c.BindInterface
+	}
+
+	for k, v := range c.Devices.Common {
+		devCommon[k] = v
 	}
 
 	exporters := make([]*Exporter, 0, len(c.Devices.List))
@@ -229,40 +509,24 @@ func New(c *config.Config, logger *logrus.Logger) (*Scraper, error) {
 		}
 
 		// Optional filters
-		var filters []filter.Filter
-		if val, ok := options["filters"]; ok {
-			var names []string
-
-			switch v := val.(type) {
-			case string:
-				names = []string{v}
-			case []interface{}:
-				names = make([]string, 0, len(v))
-				for _, vv := range v {
-					if s, ok := vv.(string); ok {
-						names = append(names, s)
-					}
-				}
-			}
-
-			if len(names) != 0 {
-				filters = make([]filter.Filter, len(names))
-
-				for i, name := range names {
-					f, ok := declaredFilters[name]
-					if !ok {
-						return nil, fmt.Errorf("Filter `%s' is not declared", name)
-					}
+		filters, err := getFilters(options["filters"], declaredFilters)
+		if err != nil {
+			return nil, err
+		}
 
-					filters[i] = f
-				}
-			}
+		outputs, err := getOutputs(options["outputs"], declaredFilters)
+		if err != nil {
+			return nil, err
 		}
 
+		split, _ := options.GetBool("split_sections")
+
 		e := Exporter{
-			Device:  drv,
-			Timeout: timeout,
-			Filters: filters,
+			Device:        drv,
+			Timeout:       timeout,
+			Filters:       filters,
+			Outputs:       outputs,
+			SplitSections: split,
 		}
 
 		exporters = append(exporters, &e)
@@ -281,7 +545,9 @@ func New(c *config.Config, logger *logrus.Logger) (*Scraper, error) {
 
 	ctx := context.Background()
 	if timeout != 0 {
-		ctx, _ = context.WithTimeout(ctx, timeout)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
 	driver, _ := c.Storage.GetString("driver")
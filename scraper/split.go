@@ -0,0 +1,97 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ecadlabs/rosdump/devices"
+	"github.com/ecadlabs/rosdump/filter"
+	"github.com/ecadlabs/rosdump/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// errorSection is the section name used to record the export error in the transaction. The file is removed as stale
+// after the next successful export
+const errorSection = "error"
+
+// sectionTx stores each RouterOS menu as a separate file. Section name is passed to the storage as `section'
+// metadata field. Files of the sections missing from the export are removed if the storage supports it
+type sectionTx struct {
+	storage.Tx
+	logger *logrus.Entry
+}
+
+func (s *sectionTx) Add(ctx context.Context, metadata devices.Metadata) (storage.WriteCloserWithError, error) {
+	return &sectionWriter{
+		ctx:      ctx,
+		tx:       s.Tx,
+		metadata: metadata,
+		logger:   s.logger,
+	}, nil
+}
+
+// sectionWriter holds the whole stream as sections can't be written until the end of the stream
+type sectionWriter struct {
+	bytes.Buffer
+	ctx      context.Context
+	tx       storage.Tx
+	metadata devices.Metadata
+	logger   *logrus.Entry
+}
+
+func (s *sectionWriter) Close() error {
+	return s.CloseWithError(nil)
+}
+
+// CloseWithError writes the sections. In case of error it's passed to the storage as a single empty section and
+// nothing is removed
+func (s *sectionWriter) CloseWithError(err error) error {
+	if err != nil {
+		wr, e := s.tx.Add(s.ctx, s.metadata.Append(devices.Metadata{
+			"section": errorSection,
+		}))
+		if e != nil {
+			return e
+		}
+
+		return wr.CloseWithError(err)
+	}
+
+	sections, err := filter.SplitRouterOS(&s.Buffer)
+	if err != nil {
+		return err
+	}
+
+	// Don't remove everything if the output is empty
+	if len(sections) == 0 {
+		return errors.New("no sections found")
+	}
+
+	for _, sec := range sections {
+		s.logger.WithField("section", sec.Name).Infoln("adding section to transaction...")
+
+		wr, err := s.tx.Add(s.ctx, s.metadata.Append(devices.Metadata{
+			"section": sec.Name,
+		}))
+		if err != nil {
+			return err
+		}
+
+		_, err = wr.Write(sec.Data)
+		if e := wr.CloseWithError(err); err == nil {
+			err = e
+		}
+
+		if err != nil {
+			return fmt.Errorf("section %s: %v", sec.Name, err)
+		}
+	}
+
+	if p, ok := s.tx.(storage.Pruner); ok {
+		return p.Prune(s.ctx, s.metadata, "section")
+	}
+
+	return nil
+}
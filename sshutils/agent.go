@@ -0,0 +1,110 @@
+package sshutils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+var errNoAgent = errors.New("SSH agent requested but SSH_AUTH_SOCK is not set")
+
+// AgentSocket interprets ssh_agent option value: true means SSH_AUTH_SOCK, non boolean string is a socket path.
+// Empty string is returned if the agent is not requested.
+func AgentSocket(v interface{}) (string, error) {
+	var enabled bool
+
+	switch vv := v.(type) {
+	case nil:
+		return "", nil
+
+	case bool:
+		enabled = vv
+
+	case string:
+		b, err := strconv.ParseBool(vv)
+		if err != nil {
+			// Socket path
+			return vv, nil
+		}
+		enabled = b
+
+	default:
+		return "", fmt.Errorf("invalid ssh_agent value: %v", v)
+	}
+
+	if !enabled {
+		return "", nil
+	}
+
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		return sock, nil
+	}
+
+	return "", errNoAgent
+}
+
+type agentClient struct {
+	socket string
+	conn   net.Conn
+	agent  agent.Agent
+	m      sync.Mutex
+}
+
+func (a *agentClient) signers() ([]ssh.Signer, error) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	// Reconnect once if the connection is broken
+	for i := 0; i < 2; i++ {
+		if a.agent == nil {
+			conn, err := net.Dial("unix", a.socket)
+			if err != nil {
+				return nil, fmt.Errorf("ssh agent: %v", err)
+			}
+
+			a.conn = conn
+			a.agent = agent.NewClient(conn)
+		}
+
+		signers, err := a.agent.Signers()
+		if err == nil {
+			return signers, nil
+		}
+
+		a.conn.Close()
+		a.agent = nil
+
+		if i != 0 {
+			return nil, fmt.Errorf("ssh agent: %v", err)
+		}
+	}
+
+	return nil, nil
+}
+
+var agents = struct {
+	clients map[string]*agentClient
+	m       sync.Mutex
+}{
+	clients: make(map[string]*agentClient),
+}
+
+// AgentSigners returns a callback listing signers held by the agent. The connection is shared and kept open
+func AgentSigners(socket string) func() ([]ssh.Signer, error) {
+	agents.m.Lock()
+	defer agents.m.Unlock()
+
+	a, ok := agents.clients[socket]
+	if !ok {
+		a = &agentClient{socket: socket}
+		agents.clients[socket] = a
+	}
+
+	return a.signers
+}
@@ -0,0 +1,285 @@
+package sshutils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"path"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Algorithms holds algorithm preferences. Library defaults are used for empty lists
+type Algorithms struct {
+	Ciphers           []string
+	KeyExchanges      []string
+	MACs              []string
+	HostKeyAlgorithms []string
+}
+
+func libraryDefaults() (ciphers, kex, macs []string) {
+	var c ssh.Config
+	c.SetDefaults()
+	return c.Ciphers, c.KeyExchanges, c.MACs
+}
+
+// Default algorithm lists used as a base for `+', `-' and `^' modifiers
+var (
+	DefaultCiphers, DefaultKeyExchanges, DefaultMACs = libraryDefaults()
+
+	DefaultHostKeyAlgorithms = []string{
+		ssh.CertAlgoRSAv01, ssh.CertAlgoDSAv01, ssh.CertAlgoECDSA256v01,
+		ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01, ssh.CertAlgoED25519v01,
+		ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+		ssh.KeyAlgoRSA, ssh.KeyAlgoDSA,
+		ssh.KeyAlgoED25519,
+	}
+)
+
+// Algorithm presets
+var AlgorithmPresets = map[string]*Algorithms{
+	"default": {
+		Ciphers:           DefaultCiphers,
+		KeyExchanges:      DefaultKeyExchanges,
+		MACs:              DefaultMACs,
+		HostKeyAlgorithms: DefaultHostKeyAlgorithms,
+	},
+	// Defaults extended with CBC ciphers offered by old devices i.e. RouterOS 5/6.
+	// SHA-1 key exchanges and DSA host keys are already enabled by default
+	"legacy": {
+		Ciphers:           ParseAlgorithms("+aes128-cbc,3des-cbc", DefaultCiphers),
+		KeyExchanges:      DefaultKeyExchanges,
+		MACs:              DefaultMACs,
+		HostKeyAlgorithms: DefaultHostKeyAlgorithms,
+	},
+	// No SHA-1, CBC modes, DSA or RSA host keys
+	"modern": {
+		Ciphers: []string{
+			"chacha20-poly1305@openssh.com", "aes128-gcm@openssh.com",
+			"aes256-ctr", "aes192-ctr", "aes128-ctr",
+		},
+		KeyExchanges: []string{
+			"curve25519-sha256@libssh.org",
+			"ecdh-sha2-nistp521", "ecdh-sha2-nistp384", "ecdh-sha2-nistp256",
+		},
+		MACs: []string{
+			"hmac-sha2-256-etm@openssh.com", "hmac-sha2-256",
+		},
+		HostKeyAlgorithms: []string{
+			ssh.CertAlgoED25519v01, ssh.CertAlgoECDSA521v01, ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA256v01,
+			ssh.KeyAlgoED25519, ssh.KeyAlgoECDSA521, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA256,
+		},
+	},
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseAlgorithms interprets OpenSSH style algorithm list. A list starting with `+' is appended to defaults,
+// `-' removes matching algorithms from defaults and `^' puts the list in front of defaults.
+func ParseAlgorithms(spec string, defaults []string) []string {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil
+	}
+
+	var mod byte
+	switch spec[0] {
+	case '+', '-', '^':
+		mod = spec[0]
+		spec = spec[1:]
+	}
+
+	var list []string
+	for _, s := range strings.Split(spec, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+
+	var res []string
+
+	switch mod {
+	case '+':
+		res = append(res, defaults...)
+		for _, a := range list {
+			if !matchAny(res, a) {
+				res = append(res, a)
+			}
+		}
+
+	case '-':
+		for _, a := range defaults {
+			if !matchAny(list, a) {
+				res = append(res, a)
+			}
+		}
+
+	case '^':
+		res = append(res, list...)
+		for _, a := range defaults {
+			if !matchAny(list, a) {
+				res = append(res, a)
+			}
+		}
+
+	default:
+		res = list
+	}
+
+	return res
+}
+
+// NegotiatedAlgorithms holds algorithms agreed upon during the key exchange
+type NegotiatedAlgorithms struct {
+	KeyExchange string
+	HostKey     string
+	Cipher      string
+	// Empty for AEAD ciphers
+	MAC string
+}
+
+// Same as kexInitMsg from x/crypto/ssh
+type kexInitMsg struct {
+	Cookie                  [16]byte `sshtype:"20"`
+	KexAlgos                []string
+	ServerHostKeyAlgos      []string
+	CiphersClientServer     []string
+	CiphersServerClient     []string
+	MACsClientServer        []string
+	MACsServerClient        []string
+	CompressionClientServer []string
+	CompressionServerClient []string
+	LanguagesClientServer   []string
+	LanguagesServerClient   []string
+	FirstKexFollows         bool
+	Reserved                uint32
+}
+
+const maxKexInitPacket = 256 * 1024
+
+// kexSniffer captures the server's first unencrypted KEXINIT message
+type kexSniffer struct {
+	net.Conn
+	buf     bytes.Buffer
+	version bool
+	done    bool
+	msg     *kexInitMsg
+	m       sync.Mutex
+}
+
+func (k *kexSniffer) Read(p []byte) (int, error) {
+	n, err := k.Conn.Read(p)
+
+	k.m.Lock()
+	if !k.done && n > 0 {
+		k.buf.Write(p[:n])
+		k.parse()
+	}
+	k.m.Unlock()
+
+	return n, err
+}
+
+func (k *kexSniffer) parse() {
+	// Skip version exchange and optional preceding lines
+	for !k.version {
+		i := bytes.IndexByte(k.buf.Bytes(), '\n')
+		if i < 0 {
+			if k.buf.Len() > maxKexInitPacket {
+				k.done = true
+			}
+			return
+		}
+
+		line := k.buf.Next(i + 1)
+		k.version = bytes.HasPrefix(line, []byte("SSH-"))
+	}
+
+	data := k.buf.Bytes()
+	if len(data) < 5 {
+		return
+	}
+
+	length := binary.BigEndian.Uint32(data)
+	if length > maxKexInitPacket {
+		k.done = true
+		return
+	}
+
+	if uint32(len(data)-4) < length {
+		return
+	}
+
+	k.done = true
+
+	padding := uint32(data[4])
+	if padding+1 > length {
+		return
+	}
+
+	var msg kexInitMsg
+	if err := ssh.Unmarshal(data[5:4+length-padding], &msg); err == nil {
+		k.msg = &msg
+	}
+
+	k.buf = bytes.Buffer{}
+}
+
+func findCommon(client, server []string) string {
+	for _, c := range client {
+		for _, s := range server {
+			if c == s {
+				return c
+			}
+		}
+	}
+	return ""
+}
+
+func isAEAD(cipher string) bool {
+	return cipher == "aes128-gcm@openssh.com" || cipher == "chacha20-poly1305@openssh.com"
+}
+
+// negotiated repeats the library's algorithm negotiation using captured server preferences
+func (k *kexSniffer) negotiated(c *Algorithms) *NegotiatedAlgorithms {
+	k.m.Lock()
+	msg := k.msg
+	k.m.Unlock()
+
+	if msg == nil {
+		return nil
+	}
+
+	conf := ssh.Config{
+		Ciphers:      c.Ciphers,
+		KeyExchanges: c.KeyExchanges,
+		MACs:         c.MACs,
+	}
+	conf.SetDefaults()
+
+	hostKeyAlgos := c.HostKeyAlgorithms
+	if hostKeyAlgos == nil {
+		hostKeyAlgos = DefaultHostKeyAlgorithms
+	}
+
+	res := NegotiatedAlgorithms{
+		KeyExchange: findCommon(conf.KeyExchanges, msg.KexAlgos),
+		HostKey:     findCommon(hostKeyAlgos, msg.ServerHostKeyAlgos),
+		Cipher:      findCommon(conf.Ciphers, msg.CiphersClientServer),
+	}
+
+	if !isAEAD(res.Cipher) {
+		res.MAC = findCommon(conf.MACs, msg.MACsClientServer)
+	}
+
+	return &res
+}
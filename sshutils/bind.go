@@ -0,0 +1,61 @@
+package sshutils
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// BindDialer originates connections from the specified source address and/or network interface
+type BindDialer struct {
+	// Source IP address
+	Address string
+	// Interface (i.e. VRF device) name
+	Interface string
+}
+
+// NewBindDialer returns nil if both address and interface are empty
+func NewBindDialer(address, iface string) (*BindDialer, error) {
+	if address == "" && iface == "" {
+		return nil, nil
+	}
+
+	if address != "" && net.ParseIP(address) == nil {
+		return nil, fmt.Errorf("bind_address: invalid IP address: `%s'", address)
+	}
+
+	if iface != "" && !bindInterfaceSupported {
+		return nil, fmt.Errorf("bind_interface: not supported on this platform")
+	}
+
+	return &BindDialer{
+		Address:   address,
+		Interface: iface,
+	}, nil
+}
+
+func (b *BindDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	var d net.Dialer
+
+	if b.Address != "" {
+		d.LocalAddr = &net.TCPAddr{IP: net.ParseIP(b.Address)}
+	}
+
+	if b.Interface != "" {
+		d.Control = func(network, address string, c syscall.RawConn) error {
+			var err error
+			if e := c.Control(func(fd uintptr) {
+				err = bindToInterface(fd, b.Interface)
+			}); e != nil {
+				return e
+			}
+			if err != nil {
+				return fmt.Errorf("bind to %s: %v", b.Interface, err)
+			}
+			return nil
+		}
+	}
+
+	return d.DialContext(ctx, network, address)
+}
@@ -0,0 +1,9 @@
+package sshutils
+
+import "syscall"
+
+const bindInterfaceSupported = true
+
+func bindToInterface(fd uintptr, iface string) error {
+	return syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface)
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package sshutils
+
+import "errors"
+
+const bindInterfaceSupported = false
+
+func bindToInterface(fd uintptr, iface string) error {
+	return errors.New("not supported")
+}
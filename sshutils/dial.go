@@ -2,24 +2,90 @@ package sshutils
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/ssh"
 )
 
-type KeyFunc func() ([]byte, error)
-
-type Config struct {
-	KeyFunc  KeyFunc
+// Credentials is a set of authentication parameters
+type Credentials struct {
+	// Optional name to tell sets apart
+	Name     string
 	Username string
+	// Password is also used to answer keyboard-interactive prompts
 	Password string
+	// Private keys tried in order
+	Signers []ssh.Signer
+	// Agent socket path. Agent isn't used if empty
+	AgentSocket string
+}
+
+func (c *Credentials) authMethods() []ssh.AuthMethod {
+	var auth []ssh.AuthMethod
+
+	if len(c.Signers) != 0 {
+		auth = append(auth, ssh.PublicKeys(c.Signers...))
+	}
+
+	if c.AgentSocket != "" {
+		auth = append(auth, ssh.PublicKeysCallback(AgentSigners(c.AgentSocket)))
+	}
+
+	if c.Password != "" {
+		auth = append(auth, ssh.Password(c.Password))
+		auth = append(auth, ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+			answers := make([]string, len(questions))
+			for i := range answers {
+				answers[i] = c.Password
+			}
+			return answers, nil
+		}))
+	}
+
+	return auth
+}
+
+type Config struct {
+	// Credential sets tried in order until one is accepted
+	Credentials     []*Credentials
+	HostKeyCallback ssh.HostKeyCallback
+	// known_hosts file used to restrict host key algorithms to the recorded key types. Not used if empty
+	KnownHosts string
+	// Intermediate hosts in order of connection
+	JumpHosts []*JumpHost
+	// Used to reach the destination or the first jump host. net.Dialer is used if nil
+	Dialer Dialer
+	// Limits connection establishment time if not zero
+	ConnectTimeout time.Duration
+	// Algorithm preferences
+	Algorithms
 }
 
 type Client struct {
 	*ssh.Client
-	conn net.Conn
+	// Accepted credential set
+	Credentials *Credentials
+	// Algorithms agreed upon during the initial key exchange. Nil if unknown
+	Negotiated *NegotiatedAlgorithms
+	conn       net.Conn
+	// Jump host connection owned by the client
+	jump *Client
+}
+
+func (c *Client) Close() error {
+	err := c.Client.Close()
+
+	if c.jump != nil {
+		if e := c.jump.Close(); err == nil {
+			err = e
+		}
+	}
+
+	return err
 }
 
 func (c *Client) SetDeadline(t time.Time) error {
@@ -34,31 +100,72 @@ func (c *Client) SetWriteDeadline(t time.Time) error {
 	return c.conn.SetWriteDeadline(t)
 }
 
+func isAuthError(err error) bool {
+	return strings.Contains(err.Error(), "unable to authenticate")
+}
+
+// Dial connects to the address trying credential sets in order. Each attempt uses a new connection
 func Dial(ctx context.Context, address string, c *Config) (client *Client, err error) {
-	var auth []ssh.AuthMethod
+	if len(c.Credentials) == 0 {
+		return nil, errors.New("no credentials")
+	}
 
-	if c.KeyFunc != nil {
-		key, err := c.KeyFunc()
-		if err != nil {
-			return nil, fmt.Errorf("key func: %v", err)
+	for i, cred := range c.Credentials {
+		if client, err = dial(ctx, address, c, cred); err == nil {
+			return client, nil
 		}
 
-		signer, err := ssh.ParsePrivateKey(key)
-		if err != nil {
-			return nil, err
+		if !isAuthError(err) || i == len(c.Credentials)-1 {
+			break
 		}
-
-		auth = append(auth, ssh.PublicKeys(signer))
 	}
 
-	if c.Password != "" {
-		auth = append(auth, ssh.Password(c.Password))
+	return nil, err
+}
+
+func dial(ctx context.Context, address string, c *Config, cred *Credentials) (client *Client, err error) {
+	if c.ConnectTimeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.ConnectTimeout)
+		defer cancel()
 	}
 
-	var dialer net.Dialer
-	conn, err := dialer.DialContext(ctx, "tcp", address)
-	if err != nil {
-		return nil, err
+	var (
+		conn net.Conn
+		jump *Client
+	)
+
+	if len(c.JumpHosts) != 0 {
+		var (
+			jc    *Client
+			owned bool
+		)
+
+		if jc, owned, err = dialJump(ctx, c.JumpHosts); err != nil {
+			return nil, fmt.Errorf("jump host %s: %v", c.JumpHosts[len(c.JumpHosts)-1].Address, err)
+		}
+
+		if owned {
+			jump = jc
+			defer func() {
+				if err != nil {
+					jc.Close()
+				}
+			}()
+		}
+
+		if conn, err = forward(ctx, jc.Client, address); err != nil {
+			return nil, err
+		}
+	} else {
+		var dialer Dialer = &net.Dialer{}
+		if c.Dialer != nil {
+			dialer = c.Dialer
+		}
+
+		if conn, err = dialer.DialContext(ctx, "tcp", address); err != nil {
+			return nil, err
+		}
 	}
 
 	defer func() {
@@ -67,10 +174,21 @@ func Dial(ctx context.Context, address string, c *Config) (client *Client, err e
 		}
 	}()
 
+	algorithms := c.Algorithms
+	if c.KnownHosts != "" {
+		algorithms.HostKeyAlgorithms = KnownHostKeyAlgorithms(c.KnownHosts, address, c.HostKeyAlgorithms)
+	}
+
 	config := ssh.ClientConfig{
-		User:            c.Username,
-		Auth:            auth,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Config: ssh.Config{
+			Ciphers:      c.Ciphers,
+			KeyExchanges: c.KeyExchanges,
+			MACs:         c.MACs,
+		},
+		User:              cred.Username,
+		Auth:              cred.authMethods(),
+		HostKeyCallback:   c.HostKeyCallback,
+		HostKeyAlgorithms: algorithms.HostKeyAlgorithms,
 	}
 
 	var (
@@ -83,10 +201,11 @@ func Dial(ctx context.Context, address string, c *Config) (client *Client, err e
 		conn.SetDeadline(d)
 	}
 
+	sniffer := kexSniffer{Conn: conn}
 	ch := make(chan struct{})
 
 	go func() {
-		sshConn, chans, reqs, err = ssh.NewClientConn(conn, address, &config)
+		sshConn, chans, reqs, err = ssh.NewClientConn(&sniffer, address, &config)
 		close(ch)
 	}()
 
@@ -103,8 +222,11 @@ func Dial(ctx context.Context, address string, c *Config) (client *Client, err e
 	conn.SetDeadline(time.Time{})
 
 	client = &Client{
-		Client: ssh.NewClient(sshConn, chans, reqs),
-		conn:   conn,
+		Client:      ssh.NewClient(sshConn, chans, reqs),
+		Credentials: cred,
+		Negotiated:  sniffer.negotiated(&algorithms),
+		conn:        conn,
+		jump:        jump,
 	}
 
 	return client, nil
@@ -0,0 +1,213 @@
+package sshutils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Host key policies
+const (
+	// Check against OpenSSH known_hosts file
+	HostKeyStrict = "strict"
+	// Record the first seen key and refuse later changes
+	HostKeyTOFU = "tofu"
+	// Accept any key
+	HostKeyInsecure = "insecure"
+)
+
+const (
+	DefaultKnownHosts   = "~/.ssh/known_hosts"
+	DefaultHostKeyStore = "~/.rosdump/known_hosts"
+)
+
+type tofuStore struct {
+	path string
+	m    sync.Mutex
+}
+
+var tofuStores = struct {
+	stores map[string]*tofuStore
+	m      sync.Mutex
+}{
+	stores: make(map[string]*tofuStore),
+}
+
+func getTOFUStore(path string) *tofuStore {
+	tofuStores.m.Lock()
+	defer tofuStores.m.Unlock()
+
+	if s, ok := tofuStores.stores[path]; ok {
+		return s
+	}
+
+	s := tofuStore{path: path}
+	tofuStores.stores[path] = &s
+
+	return &s
+}
+
+func (t *tofuStore) check(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	// The store is created on first use so a failure affects only the devices relying on it
+	if err := os.MkdirAll(filepath.Dir(t.path), 0700); err != nil {
+		return err
+	}
+
+	fd, err := os.OpenFile(t.path, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return err
+	}
+	fd.Close()
+
+	cb, err := knownhosts.New(t.path)
+	if err != nil {
+		return err
+	}
+
+	err = cb(hostname, remote, key)
+	if ke, ok := err.(*knownhosts.KeyError); ok && len(ke.Want) == 0 {
+		// First use
+		fd, err := os.OpenFile(t.path, os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+
+		_, err = fmt.Fprintln(fd, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+		return err
+	}
+
+	return err
+}
+
+// knownHostsCallback reads the known_hosts file on each check so a missing or broken file fails only
+// the connection being verified instead of the whole run
+func knownHostsCallback(path string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		cb, err := knownhosts.New(path)
+		if err != nil {
+			return fmt.Errorf("host key verification failed: %v", err)
+		}
+		return cb(hostname, remote, key)
+	}
+}
+
+func hostKeyError(cb ssh.HostKeyCallback) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := cb(hostname, remote, key)
+		switch e := err.(type) {
+		case *knownhosts.KeyError:
+			if len(e.Want) == 0 {
+				return fmt.Errorf("host key verification failed: unknown %s key for %s", key.Type(), hostname)
+			}
+			return fmt.Errorf("host key verification failed: %s key for %s doesn't match one recorded in %s:%d", key.Type(), hostname, e.Want[0].Filename, e.Want[0].Line)
+
+		case *knownhosts.RevokedError:
+			return fmt.Errorf("host key verification failed: %s key for %s is revoked", key.Type(), hostname)
+		}
+
+		return err
+	}
+}
+
+// probeKey matches no known key so the known_hosts lookup returns all keys recorded for the host
+type probeKey struct{}
+
+func (probeKey) Type() string                        { return "rosdump-probe" }
+func (probeKey) Marshal() []byte                     { return []byte("rosdump-probe") }
+func (probeKey) Verify([]byte, *ssh.Signature) error { return errors.New("probe key") }
+
+// KnownHostKeyAlgorithms restricts the host key algorithms to types of the keys recorded for the address
+// in the known_hosts file like OpenSSH does, so the server doesn't present a key of a type which can't be verified.
+// Preference order is kept. The list is returned as is (nil meaning defaults) if no keys are recorded
+func KnownHostKeyAlgorithms(file, address string, algorithms []string) []string {
+	if file == "" {
+		file = DefaultKnownHosts
+	}
+
+	path, err := homedir.Expand(file)
+	if err != nil {
+		return algorithms
+	}
+
+	cb, err := knownhosts.New(path)
+	if err != nil {
+		return algorithms
+	}
+
+	ke, ok := cb(address, &net.TCPAddr{IP: net.IPv4zero}, probeKey{}).(*knownhosts.KeyError)
+	if !ok || len(ke.Want) == 0 {
+		return algorithms
+	}
+
+	// Plain key algorithms are named after key types
+	known := make(map[string]bool, len(ke.Want))
+	for _, k := range ke.Want {
+		known[k.Key.Type()] = true
+	}
+
+	if algorithms == nil {
+		algorithms = DefaultHostKeyAlgorithms
+	}
+
+	var res []string
+	for _, a := range algorithms {
+		if known[a] {
+			res = append(res, a)
+		}
+	}
+
+	// Let the handshake fail with a meaningful error
+	if len(res) == 0 {
+		return algorithms
+	}
+
+	return res
+}
+
+// NewHostKeyCallback returns a host key callback implementing the policy. file is a known_hosts file
+// for the strict policy or a key store for the TOFU policy. Empty file names are substituted with defaults.
+// Files are read at verification time. Empty policy accepts any key like rosdump did before host key
+// verification was introduced
+func NewHostKeyCallback(policy, file string) (ssh.HostKeyCallback, error) {
+	switch policy {
+	case HostKeyStrict:
+		if file == "" {
+			file = DefaultKnownHosts
+		}
+
+		path, err := homedir.Expand(file)
+		if err != nil {
+			return nil, err
+		}
+
+		return hostKeyError(knownHostsCallback(path)), nil
+
+	case HostKeyTOFU:
+		if file == "" {
+			file = DefaultHostKeyStore
+		}
+
+		path, err := homedir.Expand(file)
+		if err != nil {
+			return nil, err
+		}
+
+		return hostKeyError(getTOFUStore(path).check), nil
+
+	case HostKeyInsecure, "":
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	return nil, fmt.Errorf("unknown host key policy: `%s'", policy)
+}
@@ -0,0 +1,161 @@
+package sshutils
+
+import (
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newTestHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func TestHostKeyCallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rosdump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	known, other := newTestHostKey(t), newTestHostKey(t)
+	remote := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 22}
+
+	knownHosts := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize("router:22")}, known) + "\n"
+	if err := ioutil.WriteFile(knownHosts, []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	type check struct {
+		hostname string
+		key      ssh.PublicKey
+		ok       bool
+	}
+
+	tests := []struct {
+		name   string
+		policy string
+		file   string
+		checks []check
+	}{
+		{
+			name:   "strict",
+			policy: HostKeyStrict,
+			file:   knownHosts,
+			checks: []check{
+				{hostname: "router:22", key: known, ok: true},
+				{hostname: "router:22", key: other},
+				{hostname: "unknown:22", key: known},
+			},
+		},
+		{
+			name:   "strict missing file",
+			policy: HostKeyStrict,
+			file:   filepath.Join(dir, "missing"),
+			checks: []check{
+				{hostname: "router:22", key: known},
+			},
+		},
+		{
+			name:   "tofu",
+			policy: HostKeyTOFU,
+			file:   filepath.Join(dir, "store", "known_hosts"),
+			checks: []check{
+				{hostname: "router:22", key: known, ok: true},
+				{hostname: "router:22", key: known, ok: true},
+				{hostname: "router:22", key: other},
+				{hostname: "other:22", key: other, ok: true},
+			},
+		},
+		{
+			name:   "insecure",
+			policy: HostKeyInsecure,
+			checks: []check{
+				{hostname: "router:22", key: other, ok: true},
+			},
+		},
+		{
+			name: "unset",
+			checks: []check{
+				{hostname: "router:22", key: other, ok: true},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Files are only touched during verification
+			cb, err := NewHostKeyCallback(test.policy, test.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, c := range test.checks {
+				err := cb(c.hostname, remote, c.key)
+				if (err == nil) != c.ok {
+					t.Errorf("check %d (%s): got %v", i, c.hostname, err)
+				}
+			}
+		})
+	}
+
+	if _, err := NewHostKeyCallback("paranoid", ""); err == nil {
+		t.Error("unknown policy accepted")
+	}
+}
+
+func TestKnownHostKeyAlgorithms(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rosdump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	knownHosts := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize("router:2222")}, newTestHostKey(t)) + "\n"
+	if err := ioutil.WriteFile(knownHosts, []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	algorithms := []string{ssh.KeyAlgoECDSA256, ssh.KeyAlgoED25519, ssh.KeyAlgoRSA}
+
+	tests := []struct {
+		name     string
+		file     string
+		address  string
+		expected []string
+	}{
+		{name: "known", file: knownHosts, address: "router:2222", expected: []string{ssh.KeyAlgoED25519}},
+		{name: "unknown host", file: knownHosts, address: "router:22", expected: algorithms},
+		{name: "missing file", file: filepath.Join(dir, "missing"), address: "router:2222", expected: algorithms},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := KnownHostKeyAlgorithms(test.file, test.address, algorithms)
+			if !reflect.DeepEqual(res, test.expected) {
+				t.Errorf("got %v, expected %v", res, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package sshutils
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// JumpHost is an intermediate host used to reach the destination
+type JumpHost struct {
+	Address string
+	Config  *Config
+}
+
+// tunnelConn emulates deadlines on top of a forwarded connection by closing it on expiration
+type tunnelConn struct {
+	net.Conn
+	timer *time.Timer
+	m     sync.Mutex
+}
+
+func (t *tunnelConn) SetDeadline(d time.Time) error {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+
+	if !d.IsZero() {
+		t.timer = time.AfterFunc(time.Until(d), func() { t.Conn.Close() })
+	}
+
+	return nil
+}
+
+func (t *tunnelConn) SetReadDeadline(d time.Time) error  { return t.SetDeadline(d) }
+func (t *tunnelConn) SetWriteDeadline(d time.Time) error { return t.SetDeadline(d) }
+
+// forward opens a direct-tcpip channel to the address
+func forward(ctx context.Context, client *ssh.Client, address string) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+
+	ch := make(chan result, 1)
+
+	go func() {
+		conn, err := client.Dial("tcp", address)
+		ch <- result{conn, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		go func() {
+			if r := <-ch; r.err == nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+
+	case r := <-ch:
+		if r.err != nil {
+			return nil, r.err
+		}
+		return &tunnelConn{Conn: r.conn}, nil
+	}
+}
+
+type poolEntry struct {
+	client *Client
+	hops   int
+	m      sync.Mutex
+}
+
+// Pool keeps jump host connections for reuse. Use WithPool to make Dial aware of it
+type Pool struct {
+	entries map[string]*poolEntry
+	m       sync.Mutex
+}
+
+func NewPool() *Pool {
+	return &Pool{
+		entries: make(map[string]*poolEntry),
+	}
+}
+
+func chainKey(chain []*JumpHost) string {
+	hops := make([]string, len(chain))
+	for i, j := range chain {
+		users := make([]string, len(j.Config.Credentials))
+		for k, c := range j.Config.Credentials {
+			users[k] = c.Username
+		}
+		hops[i] = strings.Join(users, "|") + "@" + j.Address
+	}
+
+	// Chains reached through different proxies or source addresses are distinct
+	if k := dialerKey(chain[0].Config.Dialer); k != "" {
+		return k + " " + strings.Join(hops, ",")
+	}
+	return strings.Join(hops, ",")
+}
+
+func dialerKey(d Dialer) string {
+	switch v := d.(type) {
+	case *ProxyDialer:
+		if k := dialerKey(v.Forward); k != "" {
+			return v.URL.String() + "/" + k
+		}
+		return v.URL.String()
+	case *BindDialer:
+		return v.Address + "%" + v.Interface
+	}
+	return ""
+}
+
+// get returns a connection to the last host of the chain
+func (p *Pool) get(ctx context.Context, chain []*JumpHost) (*Client, error) {
+	key := chainKey(chain)
+
+	p.m.Lock()
+	e, ok := p.entries[key]
+	if !ok {
+		e = &poolEntry{hops: len(chain)}
+		p.entries[key] = e
+	}
+	p.m.Unlock()
+
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	if e.client != nil {
+		return e.client, nil
+	}
+
+	last := chain[len(chain)-1]
+	conf := *last.Config
+	conf.JumpHosts = chain[:len(chain)-1]
+
+	client, err := Dial(ctx, last.Address, &conf)
+	if err != nil {
+		return nil, err
+	}
+
+	e.client = client
+
+	// Forget broken connection
+	go func() {
+		client.Wait()
+
+		e.m.Lock()
+		if e.client == client {
+			e.client = nil
+		}
+		e.m.Unlock()
+	}()
+
+	return client, nil
+}
+
+// Close closes all pooled connections
+func (p *Pool) Close() error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	// Close outermost hops first
+	entries := make([]*poolEntry, 0, len(p.entries))
+	for _, e := range p.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].hops > entries[j].hops })
+
+	var err error
+	for _, e := range entries {
+		e.m.Lock()
+		if e.client != nil {
+			if e := e.client.Close(); err == nil {
+				err = e
+			}
+		}
+		e.m.Unlock()
+	}
+
+	p.entries = make(map[string]*poolEntry)
+
+	return err
+}
+
+type poolKey struct{}
+
+// WithPool returns a context which makes Dial reuse jump host connections kept by the pool
+func WithPool(ctx context.Context, p *Pool) context.Context {
+	return context.WithValue(ctx, poolKey{}, p)
+}
+
+func poolFromContext(ctx context.Context) *Pool {
+	p, _ := ctx.Value(poolKey{}).(*Pool)
+	return p
+}
+
+// dialJump returns a connection to the last jump host. Returned connection is owned by the caller if not pooled
+func dialJump(ctx context.Context, chain []*JumpHost) (client *Client, owned bool, err error) {
+	if p := poolFromContext(ctx); p != nil {
+		client, err = p.get(ctx, chain)
+		return client, false, err
+	}
+
+	last := chain[len(chain)-1]
+	conf := *last.Config
+	conf.JumpHosts = chain[:len(chain)-1]
+
+	client, err = Dial(ctx, last.Address, &conf)
+	return client, true, err
+}
@@ -1,8 +1,11 @@
 package sshutils
 
 import (
+	"fmt"
 	"io/ioutil"
 	"sync"
+
+	"golang.org/x/crypto/ssh"
 )
 
 type fileCache struct {
@@ -30,3 +33,39 @@ func ReadIdentityFile(name string) ([]byte, error) {
 	idCache.data[name] = data
 	return data, nil
 }
+
+type signerCacheKey struct {
+	name       string
+	passphrase string
+}
+
+var signerCache = struct {
+	signers map[signerCacheKey]ssh.Signer
+	m       sync.Mutex
+}{
+	signers: make(map[signerCacheKey]ssh.Signer),
+}
+
+// LoadIdentity reads and decrypts the private key file. Decrypted keys are cached
+func LoadIdentity(name string, passphrase []byte) (ssh.Signer, error) {
+	signerCache.m.Lock()
+	defer signerCache.m.Unlock()
+
+	key := signerCacheKey{name, string(passphrase)}
+	if s, ok := signerCache.signers[key]; ok {
+		return s, nil
+	}
+
+	data, err := ReadIdentityFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := ParsePrivateKey(data, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	signerCache.signers[key] = s
+	return s, nil
+}
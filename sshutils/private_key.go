@@ -0,0 +1,150 @@
+package sshutils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	ErrPassphraseMissing   = errors.New("private key is encrypted but passphrase is not specified")
+	ErrPassphraseIncorrect = errors.New("incorrect private key passphrase")
+)
+
+const openSSHKeyMagic = "openssh-key-v1\x00"
+
+type openSSHKey struct {
+	CipherName   string
+	KdfName      string
+	KdfOpts      string
+	NumKeys      uint32
+	PubKey       []byte
+	PrivKeyBlock []byte
+}
+
+var openSSHCiphers = map[string]struct {
+	keyLen int
+	mode   func(block cipher.Block, iv []byte) func(dst, src []byte)
+}{
+	"aes128-ctr": {16, ctrMode},
+	"aes192-ctr": {24, ctrMode},
+	"aes256-ctr": {32, ctrMode},
+	"aes128-cbc": {16, cbcMode},
+	"aes192-cbc": {24, cbcMode},
+	"aes256-cbc": {32, cbcMode},
+}
+
+func ctrMode(block cipher.Block, iv []byte) func(dst, src []byte) {
+	return cipher.NewCTR(block, iv).XORKeyStream
+}
+
+func cbcMode(block cipher.Block, iv []byte) func(dst, src []byte) {
+	return cipher.NewCBCDecrypter(block, iv).CryptBlocks
+}
+
+// decryptOpenSSHKey returns unencrypted equivalent of the encrypted OpenSSH format key
+func decryptOpenSSHKey(data, passphrase []byte) ([]byte, error) {
+	if !strings.HasPrefix(string(data), openSSHKeyMagic) {
+		return nil, errors.New("invalid OpenSSH private key format")
+	}
+
+	var k openSSHKey
+	if err := ssh.Unmarshal(data[len(openSSHKeyMagic):], &k); err != nil {
+		return nil, err
+	}
+
+	if k.KdfName == "none" && k.CipherName == "none" {
+		return data, nil
+	}
+
+	if len(passphrase) == 0 {
+		return nil, ErrPassphraseMissing
+	}
+
+	if k.KdfName != "bcrypt" {
+		return nil, fmt.Errorf("unsupported private key KDF: %s", k.KdfName)
+	}
+
+	c, ok := openSSHCiphers[k.CipherName]
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key cipher: %s", k.CipherName)
+	}
+
+	var opts struct {
+		Salt   []byte
+		Rounds uint32
+	}
+	if err := ssh.Unmarshal([]byte(k.KdfOpts), &opts); err != nil {
+		return nil, err
+	}
+
+	key, err := bcryptPBKDF(passphrase, opts.Salt, int(opts.Rounds), c.keyLen+aes.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(k.PrivKeyBlock) < 8 || len(k.PrivKeyBlock)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid OpenSSH private key block size")
+	}
+
+	block, err := aes.NewCipher(key[:c.keyLen])
+	if err != nil {
+		return nil, err
+	}
+
+	priv := make([]byte, len(k.PrivKeyBlock))
+	c.mode(block, key[c.keyLen:])(priv, k.PrivKeyBlock)
+
+	// Both check integers match if decrypted successfully
+	if binary.BigEndian.Uint32(priv) != binary.BigEndian.Uint32(priv[4:]) {
+		return nil, ErrPassphraseIncorrect
+	}
+
+	k.CipherName = "none"
+	k.KdfName = "none"
+	k.KdfOpts = ""
+	k.PrivKeyBlock = priv
+
+	return append([]byte(openSSHKeyMagic), ssh.Marshal(&k)...), nil
+}
+
+// ParsePrivateKey parses PEM or OpenSSH format private key decrypting it with passphrase if necessary
+func ParsePrivateKey(data, passphrase []byte) (ssh.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no private key found")
+	}
+
+	if block.Type == "OPENSSH PRIVATE KEY" {
+		buf, err := decryptOpenSSHKey(block.Bytes, passphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		return ssh.ParsePrivateKey(pem.EncodeToMemory(&pem.Block{
+			Type:  block.Type,
+			Bytes: buf,
+		}))
+	}
+
+	if strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED") {
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseMissing
+		}
+
+		signer, err := ssh.ParsePrivateKeyWithPassphrase(data, passphrase)
+		if err == x509.IncorrectPasswordError {
+			return nil, ErrPassphraseIncorrect
+		}
+		return signer, err
+	}
+
+	return ssh.ParsePrivateKey(data)
+}
@@ -0,0 +1,68 @@
+package sshutils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParsePrivateKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		file       string
+		passphrase string
+		err        error
+	}{
+		{name: "openssh", file: "ed25519"},
+		{name: "openssh ignores passphrase", file: "ed25519", passphrase: "secret"},
+		{name: "openssh aes256-ctr", file: "ed25519_aes256-ctr", passphrase: "secret"},
+		{name: "openssh aes128-cbc", file: "ed25519_aes128-cbc", passphrase: "secret"},
+		{name: "openssh incorrect passphrase", file: "ed25519_aes256-ctr", passphrase: "wrong", err: ErrPassphraseIncorrect},
+		{name: "openssh missing passphrase", file: "ed25519_aes256-ctr", err: ErrPassphraseMissing},
+		{name: "pem", file: "ecdsa_pem"},
+		{name: "pem encrypted", file: "rsa_pem_encrypted", passphrase: "secret"},
+		{name: "pem incorrect passphrase", file: "rsa_pem_encrypted", passphrase: "wrong", err: ErrPassphraseIncorrect},
+		{name: "pem missing passphrase", file: "rsa_pem_encrypted", err: ErrPassphraseMissing},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := ioutil.ReadFile(filepath.Join("testdata", test.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			signer, err := ParsePrivateKey(data, []byte(test.passphrase))
+			if test.err != nil {
+				if err != test.err {
+					t.Fatalf("got error %v, expected %v", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pubData, err := ioutil.ReadFile(filepath.Join("testdata", test.file+".pub"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pub, _, _, _, err := ssh.ParseAuthorizedKey(pubData)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(signer.PublicKey().Marshal(), pub.Marshal()) {
+				t.Error("public key mismatch")
+			}
+		})
+	}
+
+	if _, err := ParsePrivateKey([]byte("not a key"), nil); err == nil {
+		t.Error("expected error")
+	}
+}
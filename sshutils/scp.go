@@ -1,12 +1,13 @@
 package sshutils
 
-/*
 import (
 	"bufio"
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -27,24 +28,39 @@ func (s *scpFileInfo) ModTime() time.Time { return time.Time{} }
 func (s *scpFileInfo) IsDir() bool        { return false }
 func (s *scpFileInfo) Sys() interface{}   { return nil }
 
+// Remote command line is interpreted by the server so only names needing no quoting are allowed
+var scpNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.+/][A-Za-z0-9_.+/-]*$`)
+
+// CheckSCPName returns an error if the file name can't be passed to the remote scp command as is
+func CheckSCPName(name string) error {
+	if !scpNameRegexp.MatchString(name) {
+		return fmt.Errorf("scp: unsupported file name: `%s'", name)
+	}
+	return nil
+}
+
+// SCPGet starts downloading of a single remote file. Response must be closed to finish the transfer
 func SCPGet(ctx context.Context, client *ssh.Client, name string) (os.FileInfo, io.ReadCloser, error) {
+	if err := CheckSCPName(name); err != nil {
+		return nil, nil, err
+	}
+
 	session, err := NewSession(ctx, client)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	var (
-		hdr       *scpFileInfo
-		cancelled bool
-	)
+	var hdr *scpFileInfo
 
 	stdout, err := session.StdoutPipe()
 	if err != nil {
+		session.Close()
 		return nil, nil, err
 	}
 
 	stdin, err := session.StdinPipe()
 	if err != nil {
+		session.Close()
 		return nil, nil, err
 	}
 
@@ -53,12 +69,10 @@ func SCPGet(ctx context.Context, client *ssh.Client, name string) (os.FileInfo,
 
 	go func() {
 		defer func() {
-			close(ch)
-
-			// Close timeouted session in the background
-			if cancelled || err != nil {
+			if err != nil {
 				session.Close()
 			}
+			close(ch)
 		}()
 
 		if err = session.Start("scp -f " + name); err != nil {
@@ -81,7 +95,9 @@ func SCPGet(ctx context.Context, client *ssh.Client, name string) (os.FileInfo,
 			return
 		}
 
-		if code == 1 {
+		headerStr = strings.TrimSpace(headerStr)
+
+		if code == 1 || code == 2 {
 			// Error response
 			err = fmt.Errorf("scp: %s", headerStr)
 			return
@@ -120,7 +136,13 @@ func SCPGet(ctx context.Context, client *ssh.Client, name string) (os.FileInfo,
 
 	select {
 	case <-ctx.Done():
-		cancelled = true
+		// Close timeouted session in the background
+		go func() {
+			<-ch
+			if err == nil {
+				session.Close()
+			}
+		}()
 		return nil, nil, ctx.Err()
 
 	case <-ch:
@@ -132,7 +154,7 @@ func SCPGet(ctx context.Context, client *ssh.Client, name string) (os.FileInfo,
 	res := sshSessionResponse{
 		Reader:  io.LimitReader(rd, hdr.size),
 		session: session,
-		closer:  stdin,
+		stdin:   stdin,
 		rd:      rd,
 	}
 
@@ -142,29 +164,41 @@ func SCPGet(ctx context.Context, client *ssh.Client, name string) (os.FileInfo,
 type sshSessionResponse struct {
 	io.Reader
 	session *ssh.Session
-	closer  io.Closer
+	stdin   io.WriteCloser
 	rd      io.Reader
 }
 
-func (s *sshSessionResponse) Close() error {
-	// Read acknowledge byte
-	var ackByte [1]byte
-	if _, err := s.rd.Read(ackByte[:]); err != nil {
+func (s *sshSessionResponse) Close() (err error) {
+	defer func() {
+		if e := s.session.Close(); err == nil && e != nil && e != io.EOF {
+			err = e
+		}
+	}()
+
+	// Read the rest of data if any
+	if _, err := io.Copy(ioutil.Discard, s.Reader); err != nil {
 		return err
 	}
 
-	if err := s.closer.Close(); err != nil {
+	// Read status byte
+	var ackByte [1]byte
+	if _, err := io.ReadFull(s.rd, ackByte[:]); err != nil {
 		return err
 	}
 
-	if err := s.session.Wait(); err != nil {
+	if ackByte[0] != 0 {
+		return fmt.Errorf("scp: transfer error: %d", ackByte[0])
+	}
+
+	// Acknowledge
+	ackByte[0] = 0
+	if _, err := s.stdin.Write(ackByte[:]); err != nil {
 		return err
 	}
 
-	if err := s.session.Close(); err != nil && err != io.EOF {
+	if err := s.stdin.Close(); err != nil {
 		return err
 	}
 
-	return nil
+	return s.session.Wait()
 }
-*/
@@ -0,0 +1,24 @@
+package sshutils
+
+import "testing"
+
+func TestCheckSCPName(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{name: "rosdump.backup", ok: true},
+		{name: "flash/rosdump-2024.backup", ok: true},
+		{name: "my backup.backup"},
+		{name: "a;reboot.backup"},
+		{name: "$(reboot).backup"},
+		{name: "-r.backup"},
+		{name: ""},
+	}
+
+	for _, test := range tests {
+		if err := CheckSCPName(test.name); (err == nil) != test.ok {
+			t.Errorf("%q: got %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package sshutils
+
+import (
+	"context"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// NewSession opens a new session. Late session is closed in the background if the context is cancelled
+func NewSession(ctx context.Context, client *ssh.Client) (*ssh.Session, error) {
+	type result struct {
+		session *ssh.Session
+		err     error
+	}
+
+	ch := make(chan result, 1)
+
+	go func() {
+		s, err := client.NewSession()
+		ch <- result{s, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		go func() {
+			if r := <-ch; r.err == nil {
+				r.session.Close()
+			}
+		}()
+		return nil, ctx.Err()
+
+	case r := <-ch:
+		return r.session, r.err
+	}
+}
+
+// Output runs the command and returns its combined output
+func Output(ctx context.Context, client *ssh.Client, command string) ([]byte, error) {
+	session, err := NewSession(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		out    []byte
+		runErr error
+		ch     = make(chan struct{})
+	)
+
+	go func() {
+		out, runErr = session.CombinedOutput(command)
+		close(ch)
+	}()
+
+	select {
+	case <-ctx.Done():
+		session.Close()
+		return nil, ctx.Err()
+
+	case <-ch:
+		session.Close()
+		return out, runErr
+	}
+}
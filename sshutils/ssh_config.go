@@ -0,0 +1,292 @@
+package sshutils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/kevinburke/ssh_config"
+	"github.com/mitchellh/go-homedir"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultUserSSHConfig   = "~/.ssh/config"
+	DefaultSystemSSHConfig = "/etc/ssh/ssh_config"
+)
+
+// Same as OpenSSH
+const sshConfigMaxDepth = 16
+
+// sshConfigPart is either a piece of a configuration file or a set of included files. Include directive
+// inside a Host block applies only to the hosts matching the block
+type sshConfigPart struct {
+	config  *ssh_config.Config
+	host    *ssh_config.Host
+	include []*sshConfigFile
+}
+
+// sshConfigFile is a parsed configuration file. Include directives are resolved here and Match blocks
+// are skipped as ssh_config fails to parse them
+type sshConfigFile struct {
+	parts []*sshConfigPart
+}
+
+// SSHConfig is a set of OpenSSH client configuration files searched in order
+type SSHConfig struct {
+	files []*sshConfigFile
+}
+
+var sshConfigs = struct {
+	configs map[string]*SSHConfig
+	m       sync.Mutex
+}{
+	configs: make(map[string]*SSHConfig),
+}
+
+// sshConfigKeyword returns the lower case keyword and the rest of the line
+func sshConfigKeyword(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return strings.ToLower(line), ""
+	}
+	return strings.ToLower(line[:i]), strings.TrimLeft(line[i:], " \t=")
+}
+
+func isSystemSSHConfig(path string) bool {
+	return strings.HasPrefix(filepath.Clean(path), filepath.Dir(DefaultSystemSSHConfig))
+}
+
+func parseSSHConfig(path string, depth int, logger *logrus.Logger) (*sshConfigFile, error) {
+	if depth > sshConfigMaxDepth {
+		return nil, fmt.Errorf("%s: include nesting is too deep", path)
+	}
+
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	var lines []string
+	s := bufio.NewScanner(fd)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	var (
+		file   sshConfigFile
+		host   string // Current Host line
+		prefix string // Host line the current part continues
+		match  bool
+		start  int // First line of the current part
+	)
+
+	// Decode a piece of the file keeping line numbers intact
+	flush := func(end int) error {
+		buf := make([]string, end)
+		copy(buf[start:], lines[start:end])
+		if start != 0 {
+			buf[start-1] = prefix
+		}
+
+		c, err := ssh_config.Decode(strings.NewReader(strings.Join(buf, "\n") + "\n"))
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+
+		file.parts = append(file.parts, &sshConfigPart{config: c})
+		return nil
+	}
+
+	for i, line := range lines {
+		kw, val := sshConfigKeyword(line)
+
+		switch {
+		case kw == "host":
+			host, match = line, false
+
+		case kw == "match":
+			logger.Warnf("%s:%d: Match blocks are not supported, skipping", path, i+1)
+			lines[i], match = "", true
+
+		case match:
+			// Skip the whole Match block
+			lines[i] = ""
+
+		case kw == "include":
+			if err := flush(i); err != nil {
+				return nil, err
+			}
+			start, prefix = i+1, host
+
+			part := sshConfigPart{}
+			if host != "" {
+				c, err := ssh_config.Decode(strings.NewReader(host + "\n"))
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", path, err)
+				}
+				part.host = c.Hosts[len(c.Hosts)-1]
+			}
+
+			for _, pattern := range strings.Fields(val) {
+				if pattern, err = homedir.Expand(pattern); err != nil {
+					return nil, err
+				}
+
+				// Relative paths are relative to ~/.ssh or /etc/ssh like in OpenSSH
+				if !filepath.IsAbs(pattern) {
+					dir := filepath.Dir(DefaultSystemSSHConfig)
+					if !isSystemSSHConfig(path) {
+						if dir, err = homedir.Expand(filepath.Dir(DefaultUserSSHConfig)); err != nil {
+							return nil, err
+						}
+					}
+					pattern = filepath.Join(dir, pattern)
+				}
+
+				matches, err := filepath.Glob(pattern)
+				if err != nil {
+					return nil, fmt.Errorf("%s:%d: %v", path, i+1, err)
+				}
+
+				for _, m := range matches {
+					f, err := parseSSHConfig(m, depth+1, logger)
+					if err != nil {
+						return nil, err
+					}
+					part.include = append(part.include, f)
+				}
+			}
+
+			file.parts = append(file.parts, &part)
+		}
+	}
+
+	if err := flush(len(lines)); err != nil {
+		return nil, err
+	}
+
+	return &file, nil
+}
+
+// LoadSSHConfig parses OpenSSH client configuration file. Empty path means user's ~/.ssh/config followed by
+// system wide /etc/ssh/ssh_config, missing files are skipped in that case. Parsed files are cached.
+// Unsupported Match blocks are skipped with a warning
+func LoadSSHConfig(path string, logger *logrus.Logger) (*SSHConfig, error) {
+	sshConfigs.m.Lock()
+	defer sshConfigs.m.Unlock()
+
+	if c, ok := sshConfigs.configs[path]; ok {
+		return c, nil
+	}
+
+	var c SSHConfig
+
+	if path == "" {
+		for _, p := range []string{DefaultUserSSHConfig, DefaultSystemSSHConfig} {
+			p, err := homedir.Expand(p)
+			if err != nil {
+				return nil, err
+			}
+
+			f, err := parseSSHConfig(p, 0, logger)
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return nil, err
+			}
+
+			c.files = append(c.files, f)
+		}
+	} else {
+		p, err := homedir.Expand(path)
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := parseSSHConfig(p, 0, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		c.files = []*sshConfigFile{f}
+	}
+
+	sshConfigs.configs[path] = &c
+
+	return &c, nil
+}
+
+var errSSHConfigFound = errors.New("found")
+
+// walk calls fn for each value of the keyword applicable to the host alias in order of appearance
+func (f *sshConfigFile) walk(alias, key string, fn func(val string) error) error {
+	for _, p := range f.parts {
+		if p.config != nil {
+			for _, h := range p.config.Hosts {
+				if !h.Matches(alias) {
+					continue
+				}
+
+				for _, n := range h.Nodes {
+					if kv, ok := n.(*ssh_config.KV); ok && strings.EqualFold(kv.Key, key) {
+						if err := fn(kv.Value); err != nil {
+							return err
+						}
+					}
+				}
+			}
+			continue
+		}
+
+		if p.host != nil && !p.host.Matches(alias) {
+			continue
+		}
+
+		for _, inc := range p.include {
+			if err := inc.walk(alias, key, fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Get returns the first value of the keyword applicable to the host alias. Empty string is returned if not found
+func (c *SSHConfig) Get(alias, key string) (val string, err error) {
+	for _, f := range c.files {
+		err := f.walk(alias, key, func(v string) error {
+			val = v
+			return errSSHConfigFound
+		})
+		if err == errSSHConfigFound {
+			return val, nil
+		}
+	}
+
+	return "", nil
+}
+
+// GetAll returns all values of the keyword applicable to the host alias i.e. IdentityFile
+func (c *SSHConfig) GetAll(alias, key string) ([]string, error) {
+	var res []string
+	for _, f := range c.files {
+		f.walk(alias, key, func(v string) error {
+			res = append(res, v)
+			return nil
+		})
+	}
+
+	return res, nil
+}
@@ -0,0 +1,140 @@
+package sshutils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestSSHConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rosdump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"config": `IdentityFile ~/.ssh/id_default
+
+Host core-*
+	HostName %h.example.com
+	IdentityFile ~/.ssh/id_core
+	IdentityFile ~/.ssh/id_ed25519
+
+Match host edge exec "true"
+	User matched
+	Include ` + filepath.Join(dir, "missing") + `
+
+Host edge
+	User admin
+	Include ` + filepath.Join(dir, "conf.d", "*") + `
+	Port 2222
+
+Host *
+	User default
+	IdentityFile ~/.ssh/id_any
+`,
+		"conf.d/a": `Port 2200
+Match all
+	Port 1
+Host edge
+	Ciphers aes128-ctr
+`,
+		"conf.d/b": `Port 2201
+`,
+	}
+
+	for name, data := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &buf
+
+	c, err := LoadSSHConfig(filepath.Join(dir, "config"), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if warnings := strings.Count(buf.String(), "Match blocks are not supported"); warnings != 2 {
+		t.Errorf("got %d warnings, expected 2", warnings)
+	}
+
+	get := []struct {
+		alias string
+		key   string
+		value string
+	}{
+		{alias: "core-1", key: "HostName", value: "%h.example.com"},
+		{alias: "core-1", key: "hostname", value: "%h.example.com"},
+		{alias: "core-1", key: "User", value: "default"},
+		{alias: "edge", key: "User", value: "admin"},
+		{alias: "edge", key: "Port", value: "2200"},
+		{alias: "edge", key: "Ciphers", value: "aes128-ctr"},
+		{alias: "other", key: "Port", value: ""},
+		{alias: "other", key: "Ciphers", value: ""},
+	}
+
+	for _, g := range get {
+		v, err := c.Get(g.alias, g.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != g.value {
+			t.Errorf("%s %s: got %q, expected %q", g.alias, g.key, v, g.value)
+		}
+	}
+
+	getAll := []struct {
+		alias  string
+		key    string
+		values []string
+	}{
+		{alias: "core-1", key: "IdentityFile", values: []string{"~/.ssh/id_default", "~/.ssh/id_core", "~/.ssh/id_ed25519", "~/.ssh/id_any"}},
+		{alias: "edge", key: "IdentityFile", values: []string{"~/.ssh/id_default", "~/.ssh/id_any"}},
+		{alias: "edge", key: "Port", values: []string{"2200", "2201", "2222"}},
+		{alias: "other", key: "Port"},
+	}
+
+	for _, g := range getAll {
+		v, err := c.GetAll(g.alias, g.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(v, g.values) {
+			t.Errorf("%s %s: got %q, expected %q", g.alias, g.key, v, g.values)
+		}
+	}
+}
+
+func TestSSHConfigIncludeLoop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rosdump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(p, []byte("Include "+p+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	if _, err := LoadSSHConfig(p, logger); err == nil {
+		t.Error("expected error")
+	}
+}
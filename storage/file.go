@@ -4,10 +4,13 @@ import (
 	"compress/gzip"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
@@ -25,12 +28,15 @@ type FileStorage struct {
 type fileStorageTx struct {
 	f         *FileStorage
 	timestamp time.Time
+	paths     map[string]struct{}
+	mtx       sync.Mutex
 }
 
 func (f *FileStorage) Begin(ctx context.Context) (Tx, error) {
 	return &fileStorageTx{
 		f:         f,
 		timestamp: time.Now(),
+		paths:     make(map[string]struct{}),
 	}, nil
 }
 
@@ -60,6 +66,16 @@ func (f *fileStorageTx) Add(ctx context.Context, metadata devices.Metadata) (Wri
 		return nil, err
 	}
 
+	// Several streams (i.e. artifacts) of the same device must be written to distinct files
+	f.mtx.Lock()
+	_, ok := f.paths[outPath.String()]
+	f.paths[outPath.String()] = struct{}{}
+	f.mtx.Unlock()
+
+	if ok {
+		return nil, fmt.Errorf("file: `%s' is already written in this transaction", outPath.String())
+	}
+
 	dir := path.Dir(outPath.String())
 	if err := os.MkdirAll(dir, 0777); err != nil {
 		return nil, err
@@ -92,6 +108,39 @@ func (f *fileStorageTx) Add(ctx context.Context, metadata devices.Metadata) (Wri
 
 func (f *fileStorageTx) Timestamp() time.Time { return f.timestamp }
 
+func (f *fileStorageTx) Prune(ctx context.Context, metadata devices.Metadata, field string) error {
+	dir, prefix, suffix, err := prunePattern(f.f.pathTpl, metadata, field)
+	if err != nil {
+		return fmt.Errorf("file: %v", err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("file: %v", err)
+	}
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	for _, fi := range files {
+		if fi.IsDir() || !isStale(fi.Name(), dir, prefix, suffix, f.paths) {
+			continue
+		}
+
+		name := path.Join(dir, fi.Name())
+		f.f.logger.WithField("file", name).Infoln("removing stale file...")
+
+		if err := os.Remove(name); err != nil {
+			return fmt.Errorf("file: %v", err)
+		}
+	}
+
+	return nil
+}
+
 func (f *fileStorageTx) Commit(ctx context.Context) error { return nil }
 
 func NewFileStorage(pathTpl string, compress bool, logger *logrus.Logger) (*FileStorage, error) {
@@ -7,6 +7,7 @@ import (
 	"html/template"
 	"io"
 	"net/url"
+	"os"
 	"path"
 	"strings"
 	"sync"
@@ -36,6 +37,18 @@ type GitStorageConfig struct {
 	Username       string
 	Password       string
 	PemBytes       []byte
+	// Private key passphrase. Password is used if empty
+	Passphrase string
+	// SSH agent socket path
+	AgentSocket string
+	// SSH host key callback
+	HostKeyCallback ssh.HostKeyCallback
+	// SSH host key algorithms in order of preference. Library defaults are used if empty
+	HostKeyAlgorithms []string
+	// Used to reach the remote i.e. through a proxy. Direct connection is used if nil
+	Dialer sshutils.Dialer
+	// Dialer connection timeout. DefaultGitDialTimeout is used if zero
+	DialTimeout time.Duration
 
 	// Name of the remote to be pulled. If empty, uses the default.
 	RemoteName string
@@ -57,7 +70,8 @@ type GitStorageConfig struct {
 	Email         string
 	CommitMessage string
 
-	keyData []byte
+	keyData    []byte
+	transports *dialerTransports
 }
 
 type GitStorage struct {
@@ -72,7 +86,17 @@ type GitStorage struct {
 
 var errCloneURL = errors.New("git: clone URL must be specified")
 
+// authMethod returns the authentication method passed to go-git. It also carries the dialer if set
 func (g *GitStorageConfig) authMethod() (transport.AuthMethod, error) {
+	auth, err := g.remoteAuth()
+	if err != nil || g.transports == nil {
+		return auth, err
+	}
+
+	return &dialerAuth{AuthMethod: auth, transports: g.transports}, nil
+}
+
+func (g *GitStorageConfig) remoteAuth() (transport.AuthMethod, error) {
 	u, err := url.Parse(g.URL)
 	if err != nil {
 		u, err = url.Parse("ssh://" + g.URL)
@@ -96,25 +120,67 @@ func (g *GitStorageConfig) authMethod() (transport.AuthMethod, error) {
 			Username: username,
 			Password: password,
 		}, nil
-	} else {
-		if g.PemBytes != nil {
-			res, err := sshtransport.NewPublicKeys(username, g.PemBytes, g.Password)
-			if err != nil {
-				return nil, err
-			}
+	}
 
-			res.HostKeyCallback = ssh.InsecureIgnoreHostKey()
-			return res, nil
+	var auth sshtransport.AuthMethod
+	if g.PemBytes != nil {
+		passphrase := g.Passphrase
+		if passphrase == "" {
+			passphrase = g.Password
 		}
 
-		return &sshtransport.Password{
+		signer, err := sshutils.ParsePrivateKey(g.PemBytes, []byte(passphrase))
+		if err != nil {
+			return nil, err
+		}
+
+		auth = &sshtransport.PublicKeys{
+			User:   username,
+			Signer: signer,
+			HostKeyCallbackHelper: sshtransport.HostKeyCallbackHelper{
+				HostKeyCallback: g.HostKeyCallback,
+			},
+		}
+	} else if g.AgentSocket != "" {
+		auth = &sshtransport.PublicKeysCallback{
+			User:     username,
+			Callback: sshutils.AgentSigners(g.AgentSocket),
+			HostKeyCallbackHelper: sshtransport.HostKeyCallbackHelper{
+				HostKeyCallback: g.HostKeyCallback,
+			},
+		}
+	} else {
+		auth = &sshtransport.Password{
 			User:     username,
 			Password: password,
 			HostKeyCallbackHelper: sshtransport.HostKeyCallbackHelper{
-				HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+				HostKeyCallback: g.HostKeyCallback,
 			},
-		}, nil
+		}
 	}
+
+	if len(g.HostKeyAlgorithms) != 0 {
+		auth = &hostKeyAlgorithmsAuth{AuthMethod: auth, algorithms: g.HostKeyAlgorithms}
+	}
+
+	return auth, nil
+}
+
+// hostKeyAlgorithmsAuth sets host key algorithms preference
+type hostKeyAlgorithmsAuth struct {
+	sshtransport.AuthMethod
+	algorithms []string
+}
+
+func (a *hostKeyAlgorithmsAuth) ClientConfig() (*ssh.ClientConfig, error) {
+	c, err := a.AuthMethod.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	c.HostKeyAlgorithms = a.algorithms
+
+	return c, nil
 }
 
 func (g *GitStorageConfig) cloneOptions() (*git.CloneOptions, error) {
@@ -241,6 +307,10 @@ func NewGitStorage(ctx context.Context, conf *GitStorageConfig, logger *logrus.L
 		return nil, errors.New("git: Missing commit message")
 	}
 
+	if conf.Dialer != nil {
+		conf.useDialer(logger)
+	}
+
 	var (
 		repo *git.Repository
 		err  error
@@ -289,6 +359,7 @@ type gitStorageTx struct {
 	g         *GitStorage
 	timestamp time.Time
 	log       []string
+	paths     map[string]struct{}
 }
 
 func (g *GitStorage) Begin(ctx context.Context) (Tx, error) {
@@ -301,6 +372,7 @@ func (g *GitStorage) Begin(ctx context.Context) (Tx, error) {
 		g:         g,
 		wt:        wt,
 		timestamp: time.Now(),
+		paths:     make(map[string]struct{}),
 	}, nil
 }
 
@@ -359,6 +431,12 @@ func (g *gitStorageTx) Add(ctx context.Context, metadata devices.Metadata) (Writ
 	g.g.mtx.Lock()
 	defer g.g.mtx.Unlock()
 
+	// Several streams (i.e. artifacts) of the same device must be written to distinct files
+	if _, ok := g.paths[out]; ok {
+		return nil, fmt.Errorf("git: `%s' is already written in this transaction", out)
+	}
+	g.paths[out] = struct{}{}
+
 	// Use underlying FS abstraction
 	fs := g.wt.Filesystem
 
@@ -384,6 +462,44 @@ func (g *gitStorageTx) Add(ctx context.Context, metadata devices.Metadata) (Writ
 
 func (g *gitStorageTx) Timestamp() time.Time { return g.timestamp }
 
+func (g *gitStorageTx) Prune(ctx context.Context, metadata devices.Metadata, field string) error {
+	dir, prefix, suffix, err := prunePattern(g.g.destTpl, metadata, field)
+	if err != nil {
+		return fmt.Errorf("git: %v", err)
+	}
+
+	g.g.mtx.Lock()
+	defer g.g.mtx.Unlock()
+
+	fs := g.wt.Filesystem
+
+	files, err := fs.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("git: %v", err)
+	}
+
+	for _, fi := range files {
+		if fi.IsDir() || !isStale(fi.Name(), dir, prefix, suffix, g.paths) {
+			continue
+		}
+
+		name := path.Join(dir, fi.Name())
+		g.g.logger.WithField("file", name).Infoln("removing stale file...")
+
+		if _, err := g.wt.Remove(name); err != nil {
+			// Not tracked
+			if err := fs.Remove(name); err != nil {
+				return fmt.Errorf("git: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
 func (g *gitStorageTx) Commit(ctx context.Context) error {
 	tdata := devices.Metadata{
 		"time":    g.timestamp,
@@ -468,6 +584,56 @@ func newGitStorage(ctx context.Context, options config.Options, logger *logrus.L
 		conf.PemBytes = pem
 	}
 
+	passphrase, err := options.GetSecret("identity_passphrase")
+	if err != nil && err != config.ErrOptNotFound {
+		return nil, fmt.Errorf("git: %v", err)
+	}
+	conf.Passphrase = passphrase
+
+	sock, err := sshutils.AgentSocket(options["ssh_agent"])
+	if err != nil {
+		return nil, fmt.Errorf("git: %v", err)
+	}
+	conf.AgentSocket = sock
+
+	// Host keys are only verified for SSH remotes. The known_hosts file may be missing otherwise
+	if ep, err := transport.NewEndpoint(conf.URL); err == nil && ep.Protocol == "ssh" {
+		policy, _ := options.GetString("host_key_policy")
+		knownHosts, _ := options.GetString("known_hosts")
+		if policy == sshutils.HostKeyTOFU {
+			knownHosts, _ = options.GetString("host_key_store")
+		}
+
+		cb, err := sshutils.NewHostKeyCallback(policy, knownHosts)
+		if err != nil {
+			return nil, fmt.Errorf("git: %v", err)
+		}
+		conf.HostKeyCallback = cb
+
+		if policy == "" {
+			logger.WithField("url", conf.URL).Warnln("host_key_policy is not set, host keys are not verified")
+		}
+
+		if policy == sshutils.HostKeyStrict {
+			conf.HostKeyAlgorithms = sshutils.KnownHostKeyAlgorithms(knownHosts, remoteAddress(ep), nil)
+		}
+	}
+
+	proxy, _ := options.GetString("proxy")
+	dialer, err := sshutils.NewProxyDialer(proxy, nil)
+	if err != nil {
+		return nil, fmt.Errorf("git: %v", err)
+	}
+	if dialer != nil {
+		conf.Dialer = dialer
+	}
+
+	if t, _ := options.GetString("connect_timeout"); t != "" {
+		if conf.DialTimeout, err = time.ParseDuration(t); err != nil {
+			return nil, fmt.Errorf("git: connect_timeout: %v", err)
+		}
+	}
+
 	conf.RemoteName, _ = options.GetString("remote_name")
 	conf.ReferenceName, _ = options.GetString("reference_name")
 	conf.Push, _ = options.GetBool("push")
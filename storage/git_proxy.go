@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ecadlabs/rosdump/sshutils"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	httptransport "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	sshtransport "gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+)
+
+// DefaultGitDialTimeout limits connection establishment through the dialer
+const DefaultGitDialTimeout = 30 * time.Second
+
+// forwardingTransport passes SSH transport connections through the dialer. go-git dials SSH servers directly
+// and doesn't accept a custom dialer so each session connects to a loopback forwarder instead. The forwarder
+// accepts a single connection and is closed as soon as the session is established
+type forwardingTransport struct {
+	transport.Transport
+	dialer sshutils.Dialer
+	logger *logrus.Logger
+}
+
+// remoteAddress resolves the endpoint address the same way go-git does
+func remoteAddress(ep *transport.Endpoint) string {
+	host := ep.Host
+	port := ep.Port
+	if port <= 0 {
+		port = sshtransport.DefaultPort
+	}
+
+	if sshtransport.DefaultSSHConfig != nil {
+		if h := sshtransport.DefaultSSHConfig.Get(ep.Host, "Hostname"); h != "" {
+			host = h
+			if p, err := strconv.Atoi(sshtransport.DefaultSSHConfig.Get(ep.Host, "Port")); err == nil {
+				port = p
+			}
+		}
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+func (f *forwardingTransport) pipe(local net.Conn, address string) {
+	defer local.Close()
+
+	remote, err := f.dialer.DialContext(context.Background(), "tcp", address)
+	if err != nil {
+		f.logger.WithField("address", address).Errorln(err)
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+
+	// Tear down both directions when either side is closed
+	<-done
+}
+
+// listen starts a loopback forwarder to the remote address. The listener must be closed after the connection attempt
+func (f *forwardingTransport) listen(address string) (net.Listener, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		conn, err := l.Accept()
+		l.Close()
+		if err != nil {
+			// Closed after a failed attempt
+			return
+		}
+
+		f.pipe(conn, address)
+	}()
+
+	return l, nil
+}
+
+// forwardedAuth checks the host key against the real address instead of the forwarder's one
+type forwardedAuth struct {
+	sshtransport.AuthMethod
+	address string
+}
+
+func (a *forwardedAuth) ClientConfig() (*ssh.ClientConfig, error) {
+	c, err := a.AuthMethod.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if cb := c.HostKeyCallback; cb != nil {
+		c.HostKeyCallback = func(_ string, remote net.Addr, key ssh.PublicKey) error {
+			return cb(a.address, remote, key)
+		}
+	}
+
+	return c, nil
+}
+
+// forward returns the endpoint of a new forwarder along with its listener
+func (f *forwardingTransport) forward(ep *transport.Endpoint, auth transport.AuthMethod) (*transport.Endpoint, transport.AuthMethod, net.Listener, error) {
+	var err error
+	if auth == nil {
+		if auth, err = sshtransport.DefaultAuthBuilder(ep.User); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	a, ok := auth.(sshtransport.AuthMethod)
+	if !ok {
+		return nil, nil, nil, transport.ErrInvalidAuthMethod
+	}
+
+	address := remoteAddress(ep)
+
+	l, err := f.listen(address)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	local := l.Addr().(*net.TCPAddr)
+
+	e := *ep
+	e.Host = local.IP.String()
+	e.Port = local.Port
+
+	return &e, &forwardedAuth{AuthMethod: a, address: address}, l, nil
+}
+
+func (f *forwardingTransport) NewUploadPackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.UploadPackSession, error) {
+	ep, auth, l, err := f.forward(ep, auth)
+	if err != nil {
+		return nil, err
+	}
+	// The connection is made when the session is created
+	defer l.Close()
+
+	return f.Transport.NewUploadPackSession(ep, auth)
+}
+
+func (f *forwardingTransport) NewReceivePackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.ReceivePackSession, error) {
+	ep, auth, l, err := f.forward(ep, auth)
+	if err != nil {
+		return nil, err
+	}
+	// The connection is made when the session is created
+	defer l.Close()
+
+	return f.Transport.NewReceivePackSession(ep, auth)
+}
+
+// dialerTransports are SSH and HTTP transports passing connections of a single storage through its dialer
+type dialerTransports struct {
+	ssh  transport.Transport
+	http transport.Transport
+}
+
+func newDialerTransports(dialer sshutils.Dialer, timeout time.Duration, logger *logrus.Logger) *dialerTransports {
+	d := &timeoutDialer{Dialer: dialer, timeout: timeout}
+
+	return &dialerTransports{
+		ssh: &forwardingTransport{
+			Transport: sshtransport.DefaultClient,
+			dialer:    d,
+			logger:    logger,
+		},
+		http: httptransport.NewClient(&http.Client{
+			Transport: &http.Transport{
+				DialContext: d.DialContext,
+			},
+		}),
+	}
+}
+
+// timeoutDialer limits the time spent on connection establishment
+type timeoutDialer struct {
+	sshutils.Dialer
+	timeout time.Duration
+}
+
+func (t *timeoutDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	return t.Dialer.DialContext(ctx, network, address)
+}
+
+// dialerAuth carries storage's transports along with the authentication method
+type dialerAuth struct {
+	transport.AuthMethod
+	transports *dialerTransports
+}
+
+// scopedTransport passes sessions authenticated with dialerAuth to the storage's transports and the rest
+// to the default ones. go-git transports are process wide and can't be passed to clone, pull or push in this
+// version so the dialer travels along with the authentication method instead
+type scopedTransport struct {
+	transport.Transport
+}
+
+func (s *scopedTransport) transport(ep *transport.Endpoint, auth transport.AuthMethod) (transport.Transport, transport.AuthMethod) {
+	a, ok := auth.(*dialerAuth)
+	if !ok {
+		return s.Transport, auth
+	}
+
+	if ep.Protocol == "ssh" {
+		return a.transports.ssh, a.AuthMethod
+	}
+	return a.transports.http, a.AuthMethod
+}
+
+func (s *scopedTransport) NewUploadPackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.UploadPackSession, error) {
+	t, auth := s.transport(ep, auth)
+	return t.NewUploadPackSession(ep, auth)
+}
+
+func (s *scopedTransport) NewReceivePackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.ReceivePackSession, error) {
+	t, auth := s.transport(ep, auth)
+	return t.NewReceivePackSession(ep, auth)
+}
+
+var installScopedTransports sync.Once
+
+// useDialer makes storage's SSH and HTTP sessions use the dialer without affecting other storages
+func (g *GitStorageConfig) useDialer(logger *logrus.Logger) {
+	installScopedTransports.Do(func() {
+		for _, proto := range []string{"ssh", "http", "https"} {
+			client.InstallProtocol(proto, &scopedTransport{Transport: client.Protocols[proto]})
+		}
+	})
+
+	timeout := g.DialTimeout
+	if timeout == 0 {
+		timeout = DefaultGitDialTimeout
+	}
+
+	g.transports = newDialerTransports(g.Dialer, timeout, logger)
+}
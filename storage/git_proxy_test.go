@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	httptransport "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+)
+
+// testTransport records the authentication method it was called with
+type testTransport struct {
+	transport.Transport
+	auth transport.AuthMethod
+}
+
+var errTestSession = errors.New("session")
+
+func (t *testTransport) NewUploadPackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.UploadPackSession, error) {
+	t.auth = auth
+	return nil, errTestSession
+}
+
+func (t *testTransport) NewReceivePackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.ReceivePackSession, error) {
+	t.auth = auth
+	return nil, errTestSession
+}
+
+func TestScopedTransport(t *testing.T) {
+	var def testTransport
+	s := scopedTransport{Transport: &def}
+
+	storages := make([]*dialerTransports, 2)
+	for i := range storages {
+		storages[i] = &dialerTransports{ssh: &testTransport{}, http: &testTransport{}}
+	}
+
+	tests := []struct {
+		name       string
+		url        string
+		transports *dialerTransports
+		expect     func() *testTransport
+	}{
+		{name: "default", url: "https://example.com/repo.git", expect: func() *testTransport { return &def }},
+		{name: "ssh", url: "ssh://git@example.com/repo.git", transports: storages[0], expect: func() *testTransport { return storages[0].ssh.(*testTransport) }},
+		{name: "http", url: "http://example.com/repo.git", transports: storages[0], expect: func() *testTransport { return storages[0].http.(*testTransport) }},
+		{name: "other storage", url: "https://example.com/repo.git", transports: storages[1], expect: func() *testTransport { return storages[1].http.(*testTransport) }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ep, err := transport.NewEndpoint(test.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var auth transport.AuthMethod = &httptransport.BasicAuth{Username: test.name}
+			expected := auth
+			if test.transports != nil {
+				auth = &dialerAuth{AuthMethod: auth, transports: test.transports}
+			}
+
+			if _, err := s.NewUploadPackSession(ep, auth); err != errTestSession {
+				t.Fatalf("got error %v", err)
+			}
+			if tr := test.expect(); tr.auth != expected {
+				t.Errorf("upload pack: got %v", tr.auth)
+			}
+
+			test.expect().auth = nil
+			if _, err := s.NewReceivePackSession(ep, auth); err != errTestSession {
+				t.Fatalf("got error %v", err)
+			}
+			if tr := test.expect(); tr.auth != expected {
+				t.Errorf("receive pack: got %v", tr.auth)
+			}
+		})
+	}
+}
+
+type deadlineDialer struct {
+	deadline time.Time
+	ok       bool
+}
+
+func (d *deadlineDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.deadline, d.ok = ctx.Deadline()
+	return nil, errTestSession
+}
+
+func TestTimeoutDialer(t *testing.T) {
+	var d deadlineDialer
+	td := timeoutDialer{Dialer: &d, timeout: time.Minute}
+
+	start := time.Now()
+	if _, err := td.DialContext(context.Background(), "tcp", "example.com:22"); err != errTestSession {
+		t.Fatalf("got error %v", err)
+	}
+
+	if !d.ok || d.deadline.Before(start.Add(time.Minute)) || d.deadline.After(time.Now().Add(time.Minute)) {
+		t.Errorf("got deadline %v, %t", d.deadline, d.ok)
+	}
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/ecadlabs/rosdump/devices"
+)
+
+const prunePlaceholder = "rosdump-prune-placeholder"
+
+type templateExecutor interface {
+	Execute(wr io.Writer, data interface{}) error
+}
+
+// prunePattern expands the template with the field set to a placeholder. The directory and the file name prefix
+// and suffix surrounding the field value are returned. The file name must not depend on other fields, otherwise
+// files of other devices sharing the directory may match the pattern
+func prunePattern(tpl templateExecutor, metadata devices.Metadata, field string) (dir, prefix, suffix string, err error) {
+	var out strings.Builder
+	if err := tpl.Execute(&out, metadata.Append(devices.Metadata{field: prunePlaceholder})); err != nil {
+		return "", "", "", err
+	}
+
+	dir, file := path.Split(out.String())
+
+	if strings.Contains(dir, prunePlaceholder) || strings.Count(file, prunePlaceholder) != 1 {
+		return "", "", "", fmt.Errorf("`%s' field must be used once in the file name to remove stale files", field)
+	}
+
+	// Expand again with other fields missing
+	out.Reset()
+	if err := tpl.Execute(&out, devices.Metadata{field: prunePlaceholder}); err != nil || path.Base(out.String()) != file {
+		return "", "", "", fmt.Errorf("file name must not depend on fields other than `%s' to remove stale files, use a per-device directory instead", field)
+	}
+
+	i := strings.Index(file, prunePlaceholder)
+
+	return path.Clean(dir), file[:i], file[i+len(prunePlaceholder):], nil
+}
+
+// isStale reports whether the file name matches the pattern and the file was not written in the transaction
+func isStale(name, dir, prefix, suffix string, written map[string]struct{}) bool {
+	if len(name) <= len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return false
+	}
+
+	for p := range written {
+		if path.Clean(p) == path.Join(dir, name) {
+			return false
+		}
+	}
+
+	return true
+}
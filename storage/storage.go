@@ -41,3 +41,9 @@ func NewStorage(ctx context.Context, name string, options config.Options, logger
 
 	return nil, fmt.Errorf("Unknown storage driver: `%s'", name)
 }
+
+// Pruner is implemented by transactions able to remove stale files. Prune removes files produced by the path
+// template expanded with the metadata where the field takes any value, except files written in the transaction
+type Pruner interface {
+	Prune(ctx context.Context, metadata devices.Metadata, field string) error
+}